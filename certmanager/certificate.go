@@ -0,0 +1,83 @@
+package certmanager
+
+import (
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// CertificateArgs describes a certificate requested from an Issuer. cert-manager stores it in the secret SecretName
+// with the keys tls.crt, tls.key and ca.crt, and renews it including the private key.
+type CertificateArgs struct {
+	// Namespace has to be the namespace of the Issuer.
+	Namespace   pulumi.StringInput
+	SecretName  string
+	CommonName  pulumi.StringInput
+	DNSNames    pulumi.StringArrayInput
+	IPAddresses []string
+	// ClientAuth allows using the certificate for client authentication as well, e.g. between Vault nodes.
+	ClientAuth bool
+}
+
+// NewCertificate creates a cert-manager Certificate issued by issuer. The secret is created asynchronously by
+// cert-manager, so pods mounting it only start once the certificate has been issued.
+func NewCertificate(
+	ctx *pulumi.Context,
+	name string,
+	issuer *Issuer,
+	args *CertificateArgs,
+	opts ...pulumi.ResourceOption,
+) (*apiextensions.CustomResource, error) {
+	opts = append(opts, pulumi.DependsOn([]pulumi.Resource{issuer.resource}))
+
+	return apiextensions.NewCustomResource(ctx, name,
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("cert-manager.io/v1"),
+			Kind:       pulumi.String("Certificate"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(args.SecretName),
+				Namespace: args.Namespace,
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": certificateSpec(issuer, args),
+			},
+		},
+		opts...,
+	)
+}
+
+func certificateSpec(issuer *Issuer, args *CertificateArgs) pulumi.Map {
+	usages := pulumi.StringArray{
+		pulumi.String("digital signature"),
+		pulumi.String("key encipherment"),
+		pulumi.String("server auth"),
+	}
+	if args.ClientAuth {
+		usages = append(usages, pulumi.String("client auth"))
+	}
+
+	spec := pulumi.Map{
+		"secretName":  pulumi.String(args.SecretName),
+		"commonName":  args.CommonName,
+		"dnsNames":    args.DNSNames,
+		"duration":    pulumi.String(hours(issuer.validityHours)),
+		"renewBefore": pulumi.String(hours(issuer.validityHours / 3)),
+		"privateKey": pulumi.Map{
+			"algorithm":      pulumi.String("ECDSA"),
+			"size":           pulumi.Int(256),
+			"rotationPolicy": pulumi.String("Always"),
+		},
+		"usages": usages,
+		"issuerRef": pulumi.Map{
+			"name":  issuer.Name,
+			"kind":  pulumi.String("Issuer"),
+			"group": pulumi.String("cert-manager.io"),
+		},
+	}
+	if len(args.IPAddresses) > 0 {
+		spec["ipAddresses"] = pulumi.ToStringArray(args.IPAddresses)
+	}
+
+	return spec
+}
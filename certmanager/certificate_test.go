@@ -0,0 +1,45 @@
+package certmanager
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"testing"
+)
+
+func TestCertificateSpec(t *testing.T) {
+	issuer := &Issuer{Name: pulumi.String("ort-server-ca").ToStringOutput(), validityHours: 2160}
+	args := &CertificateArgs{
+		SecretName: "vault-tls",
+		CommonName: pulumi.String("vault"),
+		DNSNames:   pulumi.StringArray{pulumi.String("vault")},
+	}
+
+	spec := certificateSpec(issuer, args)
+
+	if spec["duration"] != pulumi.String("2160h") || spec["renewBefore"] != pulumi.String("720h") {
+		t.Errorf("unexpected validity: duration %v, renewBefore %v", spec["duration"], spec["renewBefore"])
+	}
+	if spec["secretName"] != pulumi.String("vault-tls") {
+		t.Errorf("unexpected secret name: %v", spec["secretName"])
+	}
+	if _, ok := spec["ipAddresses"]; ok {
+		t.Error("expected no IP addresses")
+	}
+	if usages := spec["usages"].(pulumi.StringArray); len(usages) != 3 {
+		t.Errorf("expected only server usages, got %v", usages)
+	}
+	if kind := spec["issuerRef"].(pulumi.Map)["kind"]; kind != pulumi.String("Issuer") {
+		t.Errorf("unexpected issuer kind: %v", kind)
+	}
+
+	args.IPAddresses = []string{"127.0.0.1"}
+	args.ClientAuth = true
+	spec = certificateSpec(issuer, args)
+
+	if ips := spec["ipAddresses"].(pulumi.StringArray); len(ips) != 1 || ips[0] != pulumi.String("127.0.0.1") {
+		t.Errorf("unexpected IP addresses: %v", ips)
+	}
+	usages := spec["usages"].(pulumi.StringArray)
+	if usages[len(usages)-1] != pulumi.String("client auth") {
+		t.Errorf("expected the client auth usage, got %v", usages)
+	}
+}
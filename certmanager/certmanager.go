@@ -0,0 +1,201 @@
+package certmanager
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v3"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi-tls/sdk/v4/go/tls"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	caSecretName = "cert-manager-ca"
+	issuerName   = "ort-server-ca"
+)
+
+type CertManager struct {
+	pulumi.ResourceState
+
+	// Issuer is the CA issuer the other components request their certificates from.
+	Issuer *Issuer
+
+	release  *helm.Release
+	caSecret *pulumiv1.Secret
+	issuer   *apiextensions.CustomResource
+}
+
+type Args struct {
+	Namespace    *pulumiv1.Namespace
+	ChartVersion string
+	// CAValidityHours is how long the self-signed root CA is valid. It is not renewed automatically, because all
+	// clients trusting it would have to be updated.
+	CAValidityHours int
+	// CertificateValidityHours is how long the certificates issued by the CA are valid. cert-manager renews them when a
+	// third of that period is left.
+	CertificateValidityHours int
+}
+
+// Issuer refers to a cert-manager Issuer in the namespace of the components, see NewCertificate.
+type Issuer struct {
+	Name pulumi.StringOutput
+	// CACert is the PEM encoded certificate of the CA, for clients verifying the issued certificates.
+	CACert pulumi.StringOutput
+
+	validityHours int
+	resource      pulumi.Resource
+}
+
+// NewCertManager installs cert-manager and creates a CA Issuer for a self-signed root CA. The root CA is generated by
+// this program instead of cert-manager, so that its certificate can be distributed to clients without exposing its key,
+// and nothing outside the cluster is needed to issue certificates.
+func NewCertManager(
+	ctx *pulumi.Context,
+	name string,
+	args *Args,
+	opts ...pulumi.ResourceOption,
+) (*CertManager, error) {
+	component := &CertManager{}
+	opts = append(opts, pulumi.DependsOn([]pulumi.Resource{args.Namespace}))
+	err := ctx.RegisterComponentResource("certmanager:CertManager", name, component, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	component.release, err = helm.NewRelease(
+		ctx,
+		"cert-manager",
+		&helm.ReleaseArgs{
+			Chart: pulumi.String("cert-manager"),
+			RepositoryOpts: helm.RepositoryOptsArgs{
+				Repo: pulumi.String("https://charts.jetstack.io"),
+			},
+			Version:         pulumi.String(args.ChartVersion),
+			Namespace:       pulumi.String("cert-manager"),
+			CreateNamespace: pulumi.Bool(true),
+			Values: pulumi.Map{
+				"installCRDs": pulumi.Bool(true),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert, caKey, err := createCA(ctx, component, args)
+	if err != nil {
+		return nil, err
+	}
+
+	component.caSecret, err = pulumiv1.NewSecret(
+		ctx,
+		caSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(caSecretName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			Type: pulumi.String("kubernetes.io/tls"),
+			StringData: pulumi.StringMap{
+				"tls.crt": caCert,
+				"tls.key": caKey,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The webhook of cert-manager has to be ready to accept the Issuer, which the release waits for.
+	component.issuer, err = apiextensions.NewCustomResource(ctx, issuerName,
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("cert-manager.io/v1"),
+			Kind:       pulumi.String("Issuer"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(issuerName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": pulumi.Map{
+					"ca": pulumi.Map{
+						"secretName": component.caSecret.Metadata.Name(),
+					},
+				},
+			},
+		},
+		pulumi.DependsOn([]pulumi.Resource{component.release}),
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	component.Issuer = &Issuer{
+		Name:          component.issuer.Metadata.Name().Elem(),
+		CACert:        caCert,
+		validityHours: args.CertificateValidityHours,
+		resource:      component.issuer,
+	}
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"issuerName": component.Issuer.Name,
+		"caCert":     component.Issuer.CACert,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return component, nil
+}
+
+func createCA(
+	ctx *pulumi.Context,
+	component *CertManager,
+	args *Args,
+) (pulumi.StringOutput, pulumi.StringOutput, error) {
+	key, err := tls.NewPrivateKey(
+		ctx,
+		caSecretName,
+		&tls.PrivateKeyArgs{
+			Algorithm:  pulumi.String("ECDSA"),
+			EcdsaCurve: pulumi.String("P256"),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, pulumi.StringOutput{}, err
+	}
+
+	cert, err := tls.NewSelfSignedCert(
+		ctx,
+		caSecretName,
+		&tls.SelfSignedCertArgs{
+			PrivateKeyPem: key.PrivateKeyPem,
+			Subject: tls.SelfSignedCertSubjectArgs{
+				CommonName:   pulumi.String("ORT Server CA"),
+				Organization: pulumi.String("ORT Server"),
+			},
+			IsCaCertificate:     pulumi.Bool(true),
+			ValidityPeriodHours: pulumi.Int(args.CAValidityHours),
+			AllowedUses: pulumi.StringArray{
+				pulumi.String("cert_signing"),
+				pulumi.String("crl_signing"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, pulumi.StringOutput{}, err
+	}
+
+	return cert.CertPem, key.PrivateKeyPem, nil
+}
+
+// hours formats a number of hours as a Go duration, which is the format of durations in cert-manager resources.
+func hours(h int) string {
+	return fmt.Sprintf("%dh", h)
+}
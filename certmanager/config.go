@@ -0,0 +1,33 @@
+package certmanager
+
+import (
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// LoadArgs reads the "certmanager:*" keys from the stack configuration. cert-manager is only installed if
+// "certmanager:enabled" is true, otherwise nil is returned.
+func LoadArgs(ctx *pulumi.Context, namespace *pulumiv1.Namespace) (*Args, error) {
+	cfg := common.NewConfig(ctx, "certmanager")
+
+	if !cfg.Bool("enabled", false) {
+		return nil, cfg.Err()
+	}
+
+	args := &Args{
+		Namespace:                namespace,
+		ChartVersion:             cfg.String("chartVersion", "v1.14.5"),
+		CAValidityHours:          cfg.Int("caValidityHours", 87600),
+		CertificateValidityHours: cfg.Int("certificateValidityHours", 2160),
+	}
+
+	cfg.NotEmpty("chartVersion", args.ChartVersion)
+	cfg.Positive("caValidityHours", args.CAValidityHours)
+	cfg.Positive("certificateValidityHours", args.CertificateValidityHours)
+	if args.CertificateValidityHours >= args.CAValidityHours {
+		cfg.Errorf("certificateValidityHours", "must be less than caValidityHours (%d)", args.CAValidityHours)
+	}
+
+	return args, cfg.Err()
+}
@@ -0,0 +1,101 @@
+// Command vault-unseal-controller runs the controller from the unsealcontroller package inside the cluster. It is
+// configured with environment variables:
+//
+//	NAMESPACE                the namespace of the Vault pods (required)
+//	POD_SELECTOR             label selector matching the Vault server pods (default: app.kubernetes.io/name=vault,component=server)
+//	VAULT_INTERNAL_SERVICE   headless service of the Vault pods (default: vault-internal)
+//	VAULT_SCHEME             http or https (default: http)
+//	VAULT_CACERT             path of the CA certificate used to verify Vault's listener certificates
+//	UNSEAL_KEYS_DIR          directory containing one unseal key per file (default: /vault/unseal-keys)
+//	RESYNC_INTERVAL          how often all pods are checked regardless of changes (default: 30s)
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/haikoschol/ort-server-pulumi-go/vault/unsealcontroller"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	namespace := os.Getenv("NAMESPACE")
+	if namespace == "" {
+		return fmt.Errorf("NAMESPACE must be set")
+	}
+
+	resync, err := time.ParseDuration(getenv("RESYNC_INTERVAL", "30s"))
+	if err != nil {
+		return fmt.Errorf("invalid RESYNC_INTERVAL: %w", err)
+	}
+
+	config := unsealcontroller.Config{
+		Namespace:       namespace,
+		InternalService: getenv("VAULT_INTERNAL_SERVICE", "vault-internal"),
+		Scheme:          getenv("VAULT_SCHEME", "http"),
+		KeysDir:         getenv("UNSEAL_KEYS_DIR", "/vault/unseal-keys"),
+	}
+
+	var caCert []byte
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		caCert, err = os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		config.CACert = string(caCert)
+	}
+
+	// The controller replaces the address with the one of each pod.
+	vault, err := common.NewVaultClient(fmt.Sprintf("%s://%s:8200", config.Scheme, config.InternalService), caCert)
+	if err != nil {
+		return err
+	}
+	vault.SetClientTimeout(10 * time.Second)
+
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events(namespace)})
+	defer broadcaster.Shutdown()
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "vault-unseal-controller"})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	controller := unsealcontroller.New(config, clientset, recorder, vault)
+	selector := getenv("POD_SELECTOR", "app.kubernetes.io/name=vault,component=server")
+
+	log.Printf("watching pods matching %q in namespace %s", selector, namespace)
+	return controller.Run(ctx, selector, resync)
+}
+
+func getenv(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
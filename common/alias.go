@@ -0,0 +1,22 @@
+package common
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ConfigFileAlias returns the alias of a resource that used to be created from the YAML file of the ConfigFile
+// configFile, a child of the resource with the URN parent. Without it, Pulumi creates the resource again under its new
+// URN, which fails because the Kubernetes object exists, and deletes the old one afterwards, e.g. the PVCs of a database
+// cluster. Objects from YAML files are named "<namespace>/<name>".
+func ConfigFileAlias(ctx *pulumi.Context, parent pulumi.URNInput, configFile string, object string) pulumi.Alias {
+	return pulumi.Alias{
+		Name: pulumi.String(object),
+		ParentURN: pulumi.CreateURN(
+			pulumi.String(configFile),
+			pulumi.String("kubernetes:yaml:ConfigFile"),
+			parent.ToURNOutput().ApplyT(func(urn pulumi.URN) string { return string(urn) }).(pulumi.StringOutput),
+			pulumi.String(ctx.Project()),
+			pulumi.String(ctx.Stack()),
+		),
+	}
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Config reads typed values from one namespace of the stack configuration (e.g. "postgresql" for
+// "postgresql:instances"). Missing keys fall back to the given default. Values that cannot be parsed or fail validation
+// are collected and reported together by Err, so that a single "pulumi up" lists every bad value at once.
+type Config struct {
+	namespace string
+	cfg       *config.Config
+	errs      []error
+}
+
+func NewConfig(ctx *pulumi.Context, namespace string) *Config {
+	return &Config{
+		namespace: namespace,
+		cfg:       config.New(ctx, namespace),
+	}
+}
+
+func (c *Config) String(key string, def string) string {
+	value, err := c.cfg.Try(key)
+	if err != nil {
+		c.addMissingOrError(key, err)
+		return def
+	}
+	return value
+}
+
+func (c *Config) Int(key string, def int) int {
+	value, err := c.cfg.TryInt(key)
+	if err != nil {
+		c.addMissingOrError(key, err)
+		return def
+	}
+	return value
+}
+
+func (c *Config) Bool(key string, def bool) bool {
+	value, err := c.cfg.TryBool(key)
+	if err != nil {
+		c.addMissingOrError(key, err)
+		return def
+	}
+	return value
+}
+
+// Object decodes a structured value into output. If the key is missing, output is left untouched, so callers should
+// initialise it with the default value.
+func (c *Config) Object(key string, output interface{}) {
+	err := c.cfg.TryObject(key, output)
+	if err != nil {
+		c.addMissingOrError(key, err)
+	}
+}
+
+// Secret returns a secret value, or nil if the key is missing.
+func (c *Config) Secret(key string) pulumi.StringInput {
+	value, err := c.cfg.TrySecret(key)
+	if err != nil {
+		c.addMissingOrError(key, err)
+		return nil
+	}
+	return value
+}
+
+// Positive records an error if value is not greater than zero.
+func (c *Config) Positive(key string, value int) {
+	if value < 1 {
+		c.Errorf(key, "must be greater than zero, got %d", value)
+	}
+}
+
+// NotEmpty records an error if value is an empty string.
+func (c *Config) NotEmpty(key string, value string) {
+	if value == "" {
+		c.Errorf(key, "must not be empty")
+	}
+}
+
+// OneOf records an error if value is not one of the allowed values.
+func (c *Config) OneOf(key string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	c.Errorf(key, "must be one of %q, got %q", allowed, value)
+}
+
+// Quantity records an error if value is not a valid Kubernetes resource quantity like "1Gi" or "500m".
+func (c *Config) Quantity(key string, value string) {
+	if _, err := resource.ParseQuantity(value); err != nil {
+		c.Errorf(key, "must be a Kubernetes quantity like \"1Gi\" or \"500m\", got %q", value)
+	}
+}
+
+// Errorf records a validation error for the given key.
+func (c *Config) Errorf(key string, format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Errorf("invalid configuration %s: %s", c.fullKey(key), fmt.Sprintf(format, args...)))
+}
+
+// Err returns all errors encountered while reading and validating the configuration, or nil.
+func (c *Config) Err() error {
+	return errors.Join(c.errs...)
+}
+
+func (c *Config) addMissingOrError(key string, err error) {
+	if errors.Is(err, config.ErrMissingVar) {
+		return
+	}
+	c.errs = append(c.errs, fmt.Errorf("invalid configuration %s: %w", c.fullKey(key), err))
+}
+
+func (c *Config) fullKey(key string) string {
+	return c.namespace + ":" + key
+}
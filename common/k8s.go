@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -180,6 +185,60 @@ func (kc *KubernetesClient) PodExecIgnoreExitCode(pod *corev1.Pod, command strin
 	return stdout.String(), nil
 }
 
+// PortForward forwards a random local port on 127.0.0.1 to the given port of the pod and returns the local port.
+// Forwarding continues until stop is called.
+func (kc *KubernetesClient) PortForward(pod *corev1.Pod, port int) (localPort uint16, stop func(), err error) {
+	req := kc.clientset.CoreV1().RESTClient().
+		Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(kc.namespace).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(kc.config)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+	stopChan := make(chan struct{})
+	readyChan := make(chan struct{})
+
+	fw, err := portforward.NewOnAddresses(
+		dialer,
+		[]string{"127.0.0.1"},
+		[]string{fmt.Sprintf("0:%d", port)},
+		stopChan,
+		readyChan,
+		io.Discard,
+		io.Discard,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fw.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-errChan:
+		return 0, nil, fmt.Errorf("PortForward(%s, %d): %w", pod.Name, port, err)
+	}
+
+	stop = func() { close(stopChan) }
+
+	ports, err := fw.GetPorts()
+	if err != nil {
+		stop()
+		return 0, nil, err
+	}
+
+	return ports[0].Local, stop, nil
+}
+
 func (kc *KubernetesClient) GetPod(name string) (*corev1.Pod, error) {
 	return kc.clientset.CoreV1().Pods(kc.namespace).Get(context.Background(), name, metav1.GetOptions{})
 }
@@ -209,7 +268,7 @@ func (kc *KubernetesClient) WaitForPod(name string, timeout time.Duration) (*cor
 		} else {
 			if time.Now().After(deadline) {
 				return nil, fmt.Errorf(
-					"timed out waiting for pod %s to be ready within %d seconds",
+					"timed out waiting for pod %s to be ready within %.0f seconds",
 					name,
 					timeout.Seconds(),
 				)
@@ -234,7 +293,7 @@ func (kc *KubernetesClient) WaitForPods(getPods GetPodsFunc, timeout time.Durati
 			return pods, nil
 		} else {
 			if time.Now().After(deadline) {
-				return nil, fmt.Errorf("timed out waiting for pods to be ready within %d seconds", timeout)
+				return nil, fmt.Errorf("timed out waiting for pods to be ready within %.0f seconds", timeout.Seconds())
 			}
 			time.Sleep(time.Second * 3)
 		}
@@ -264,6 +323,23 @@ func (kc *KubernetesClient) IsPodReady(pod *corev1.Pod) bool {
 	return false
 }
 
+// GetSecret returns the data of a secret, or nil if it does not exist.
+func (kc *KubernetesClient) GetSecret(name string) (map[string][]byte, error) {
+	secret, err := kc.clientset.CoreV1().Secrets(kc.namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.Data, nil
+}
+
+func (kc *KubernetesClient) Namespace() string {
+	return kc.namespace
+}
+
 func (kc *KubernetesClient) Clientset() *kubernetes.Clientset {
 	return kc.clientset
 }
@@ -0,0 +1,12 @@
+package common
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// NewSelfReference returns a reference to the outputs of the last update of the current stack, which components use to
+// read the state they exported before. The reference is a resource named after the stack, so it has to be created once
+// per program and passed to every component that needs it. A second reference would fail with a duplicate URN.
+func NewSelfReference(ctx *pulumi.Context) (*pulumi.StackReference, error) {
+	return pulumi.NewStackReference(ctx, ctx.Stack(), nil)
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"github.com/hashicorp/vault/api"
+)
+
+// NewVaultClient returns a Vault API client without a token. caCert is the PEM encoded CA certificate the listener
+// certificate of Vault is verified with, or nil to use the system CAs. The VAULT_* environment variables of the process
+// are ignored where they would affect the connection.
+func NewVaultClient(address string, caCert []byte) (*api.Client, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	config.Address = address
+	if caCert != nil {
+		if err := config.ConfigureTLS(&api.TLSConfig{CACertBytes: caCert}); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client.ClearToken()
+	client.ClearNamespace()
+	return client, nil
+}
@@ -0,0 +1,40 @@
+package keycloak
+
+import (
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// LoadClusterArgs reads the "keycloak:*" keys from the stack configuration. The HTTPS certificate is created for
+// "keycloak:hostname" and the service, unless a PEM encoded certificate is given with "keycloak:tlsCert" and the secret
+// "keycloak:tlsKey". The caller sets TLSArgs.Issuer to request it from cert-manager instead of creating it.
+func LoadClusterArgs(ctx *pulumi.Context, namespace *pulumiv1.Namespace) (*ClusterArgs, error) {
+	cfg := common.NewConfig(ctx, "keycloak")
+
+	args := &ClusterArgs{
+		Namespace: namespace,
+		Instances: cfg.Int("instances", 1),
+		Hostname:  cfg.String("hostname", "keycloak"),
+	}
+
+	cfg.Positive("instances", args.Instances)
+	cfg.NotEmpty("hostname", args.Hostname)
+
+	args.TLS = TLSArgs{
+		Cert:          cfg.String("tlsCert", ""),
+		ValidityHours: cfg.Int("tlsValidityHours", 8760),
+	}
+	cfg.Positive("tlsValidityHours", args.TLS.ValidityHours)
+	if args.TLS.Cert != "" {
+		if err := checkCertificate(args.TLS.Cert, args.Hostname); err != nil {
+			cfg.Errorf("tlsCert", "%s", err)
+		}
+		args.TLS.Key = cfg.Secret("tlsKey")
+		if args.TLS.Key == nil {
+			cfg.Errorf("tlsKey", "must be set when tlsCert is set")
+		}
+	}
+
+	return args, cfg.Err()
+}
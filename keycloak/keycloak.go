@@ -2,27 +2,53 @@ package keycloak
 
 import (
 	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
 	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	corev1 "k8s.io/api/core/v1"
-	"os"
 	"time"
 )
 
 type Cluster struct {
 	pulumi.ResourceState
 
-	tlsSecret               *pulumiv1.Secret
+	// ServiceName is the name of the HTTPS service.
+	ServiceName pulumi.StringOutput
+	Port        pulumi.IntOutput
+	// URL is the base URL of the HTTPS service.
+	URL pulumi.StringOutput
+	// AdminSecretName is the name of the secret holding the credentials of the initial admin user. It contains the
+	// keys username and password.
+	AdminSecretName pulumi.StringOutput
+	TLSSecretName   pulumi.StringOutput
+	// CASecretName is the name of the secret containing the CA certificate ("ca.crt") clients use to verify Keycloak's
+	// certificate. It is empty if the certificate is configured.
+	CASecretName pulumi.StringOutput
+
 	clusterCRDManifest      *yaml.ConfigFile
 	realmImportsCRDManifest *yaml.ConfigFile
 	operatorManifest        *yaml.ConfigFile
-	clusterManifest         *yaml.ConfigFile
+	cluster                 *apiextensions.CustomResource
 }
 
 type ClusterArgs struct {
 	Namespace *pulumiv1.Namespace
+	Instances int
+	Hostname  string
+	TLS       TLSArgs
+	Database  DatabaseArgs
+}
+
+// DatabaseArgs describes the PostgreSQL database Keycloak stores its data in.
+type DatabaseArgs struct {
+	Host pulumi.StringInput
+	Port pulumi.IntInput
+	Name pulumi.StringInput
+	// SecretName is the name of a secret with the keys username and password.
+	SecretName pulumi.StringInput
 }
 
 func NewCluster(
@@ -38,7 +64,7 @@ func NewCluster(
 		return nil, err
 	}
 
-	component.tlsSecret, err = createTLSSecret(ctx, component)
+	component.TLSSecretName, component.CASecretName, err = createTLS(ctx, component, args)
 	if err != nil {
 		return nil, err
 	}
@@ -84,50 +110,91 @@ func NewCluster(
 		}, time.Minute)
 	}
 
-	component.clusterManifest, err = yaml.NewConfigFile(ctx, "keycloak-cluster",
-		&yaml.ConfigFileArgs{
-			File: "./keycloak/cluster.yaml",
+	component.cluster, err = apiextensions.NewCustomResource(ctx, "keycloak-cluster",
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("k8s.keycloak.org/v2alpha1"),
+			Kind:       pulumi.String("Keycloak"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String("keycloak"),
+				Namespace: args.Namespace.Metadata.Name(),
+				Labels: pulumi.StringMap{
+					"app": pulumi.String("keycloak"),
+				},
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": pulumi.Map{
+					"hostname": pulumi.Map{
+						"hostname": pulumi.String(args.Hostname),
+					},
+					"instances": pulumi.Int(args.Instances),
+					"resources": pulumi.Map{
+						"requests": pulumi.Map{
+							"cpu":    pulumi.String("1"),
+							"memory": pulumi.String("1Gi"),
+						},
+						"limits": pulumi.Map{
+							"cpu":    pulumi.String("4"),
+							"memory": pulumi.String("2Gi"),
+						},
+					},
+					"db": pulumi.Map{
+						"vendor": pulumi.String("postgres"),
+						"url": pulumi.Sprintf(
+							"jdbc:postgresql://%s:%d/%s",
+							args.Database.Host,
+							args.Database.Port,
+							args.Database.Name,
+						),
+						"poolMinSize":     pulumi.Int(5),
+						"poolInitialSize": pulumi.Int(5),
+						"poolMaxSize":     pulumi.Int(30),
+						"usernameSecret": pulumi.Map{
+							"name": args.Database.SecretName,
+							"key":  pulumi.String("username"),
+						},
+						"passwordSecret": pulumi.Map{
+							"name": args.Database.SecretName,
+							"key":  pulumi.String("password"),
+						},
+					},
+					"http": pulumi.Map{
+						"tlsSecret": component.TLSSecretName,
+					},
+				},
+			},
 		},
 		pulumi.DependsOn([]pulumi.Resource{
-			component.tlsSecret,
 			component.clusterCRDManifest,
 			component.realmImportsCRDManifest,
+			component.operatorManifest,
 		}),
-		pulumi.DependsOn([]pulumi.Resource{component.tlsSecret}),
 		pulumi.ResourceOption(pulumi.Parent(component)),
+		// The cluster used to be created from keycloak/cluster.yaml.
+		pulumi.Aliases([]pulumi.Alias{
+			common.ConfigFileAlias(ctx, component.URN(), "keycloak-cluster", "ort-server/keycloak"),
+		}),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return component, nil
-}
-
-func createTLSSecret(ctx *pulumi.Context, component *Cluster) (*pulumiv1.Secret, error) {
-	tlsCert, err := os.ReadFile("./keycloak/certificate.pem")
-	if err != nil {
-		return nil, err
-	}
-
-	tlsKey, err := os.ReadFile("./keycloak/key.pem")
+	clusterName := component.cluster.Metadata.Name().Elem()
+	component.ServiceName = pulumi.Sprintf("%s-service", clusterName)
+	component.Port = pulumi.Int(8443).ToIntOutput()
+	component.URL = pulumi.Sprintf("https://%s:%d", component.ServiceName, component.Port)
+	component.AdminSecretName = pulumi.Sprintf("%s-initial-admin", clusterName)
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"serviceName":     component.ServiceName,
+		"port":            component.Port,
+		"url":             component.URL,
+		"adminSecretName": component.AdminSecretName,
+		"tlsSecretName":   component.TLSSecretName,
+		"caSecretName":    component.CASecretName,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return pulumiv1.NewSecret(
-		ctx,
-		"keycloak-tls",
-		&pulumiv1.SecretArgs{
-			Metadata: pulumimetav1.ObjectMetaArgs{
-				Name:      pulumi.String("keycloak-tls"),
-				Namespace: pulumi.String("ort-server"),
-			},
-			Type: pulumi.String("kubernetes.io/tls"),
-			StringData: pulumi.StringMap{
-				"tls.crt": pulumi.String(tlsCert),
-				"tls.key": pulumi.String(tlsKey),
-			},
-		},
-		pulumi.ResourceOption(pulumi.Parent(component)),
-	)
+	return component, nil
 }
@@ -0,0 +1,253 @@
+package keycloak
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/certmanager"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi-tls/sdk/v4/go/tls"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	tlsSecretName   = "keycloak-tls"
+	tlsCASecretName = "keycloak-tls-ca"
+	// issuedSecretName is the secret cert-manager stores the certificate in. It differs from tlsSecretName, because
+	// deleting the generated secret when switching to cert-manager would otherwise delete the issued certificate.
+	issuedSecretName = "keycloak-tls-issued"
+	// serviceName is the name of the HTTPS service the Keycloak operator creates for the cluster "keycloak".
+	serviceName = "keycloak-service"
+)
+
+// TLSArgs configures the certificate of the Keycloak HTTPS listener.
+type TLSArgs struct {
+	// Cert and Key are the PEM encoded certificate and private key to use. If Cert is empty, the certificate is
+	// requested from Issuer, or signed by a self-signed CA created for each stack if Issuer is nil.
+	Cert   string
+	Key    pulumi.StringInput
+	Issuer *certmanager.Issuer
+	// ValidityHours is how long the generated certificate is valid. It is renewed by the first deployment within the
+	// last tenth of that period.
+	ValidityHours int
+}
+
+// createTLS creates the secret with the certificate for the hostname and the service, and returns its name. Unless the
+// certificate is configured, the CA certificate is stored in keycloak-tls-ca, whose name is returned as well.
+func createTLS(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+) (pulumi.StringOutput, pulumi.StringOutput, error) {
+	noCASecret := pulumi.String("").ToStringOutput()
+
+	if args.TLS.Cert != "" {
+		secret, err := newTLSSecret(ctx, component, args, tlsSecretName, "kubernetes.io/tls", pulumi.StringMap{
+			"tls.crt": pulumi.String(args.TLS.Cert),
+			"tls.key": args.TLS.Key,
+		})
+		if err != nil {
+			return pulumi.StringOutput{}, noCASecret, err
+		}
+		return secret.Metadata.Name().Elem(), noCASecret, nil
+	}
+
+	if args.TLS.Issuer != nil {
+		return requestCertificate(ctx, component, args)
+	}
+
+	caKey, err := tls.NewPrivateKey(
+		ctx,
+		"keycloak-tls-ca",
+		&tls.PrivateKeyArgs{
+			Algorithm:  pulumi.String("ECDSA"),
+			EcdsaCurve: pulumi.String("P256"),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	caCert, err := tls.NewSelfSignedCert(
+		ctx,
+		"keycloak-tls-ca",
+		&tls.SelfSignedCertArgs{
+			PrivateKeyPem: caKey.PrivateKeyPem,
+			Subject: tls.SelfSignedCertSubjectArgs{
+				CommonName:   pulumi.String("Keycloak CA"),
+				Organization: pulumi.String("ORT Server"),
+			},
+			IsCaCertificate: pulumi.Bool(true),
+			// The CA outlives the server certificate, so that renewing it does not require distributing a new CA.
+			ValidityPeriodHours: pulumi.Int(args.TLS.ValidityHours * 10),
+			AllowedUses: pulumi.StringArray{
+				pulumi.String("cert_signing"),
+				pulumi.String("crl_signing"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	key, err := tls.NewPrivateKey(
+		ctx,
+		"keycloak-tls",
+		&tls.PrivateKeyArgs{
+			Algorithm:  pulumi.String("ECDSA"),
+			EcdsaCurve: pulumi.String("P256"),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	request, err := tls.NewCertRequest(
+		ctx,
+		"keycloak-tls",
+		&tls.CertRequestArgs{
+			PrivateKeyPem: key.PrivateKeyPem,
+			Subject: tls.CertRequestSubjectArgs{
+				CommonName: pulumi.String(args.Hostname),
+			},
+			DnsNames: dnsNames(args.Hostname, args.Namespace.Metadata.Name().Elem()),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	cert, err := tls.NewLocallySignedCert(
+		ctx,
+		"keycloak-tls",
+		&tls.LocallySignedCertArgs{
+			CertRequestPem:      request.CertRequestPem,
+			CaCertPem:           caCert.CertPem,
+			CaPrivateKeyPem:     caKey.PrivateKeyPem,
+			ValidityPeriodHours: pulumi.Int(args.TLS.ValidityHours),
+			EarlyRenewalHours:   pulumi.Int(args.TLS.ValidityHours / 10),
+			AllowedUses: pulumi.StringArray{
+				pulumi.String("digital_signature"),
+				pulumi.String("key_encipherment"),
+				pulumi.String("server_auth"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	secret, err := newTLSSecret(ctx, component, args, tlsSecretName, "kubernetes.io/tls", pulumi.StringMap{
+		"tls.crt": cert.CertPem,
+		"tls.key": key.PrivateKeyPem,
+	})
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	caSecret, err := newTLSSecret(ctx, component, args, tlsCASecretName, "Opaque", pulumi.StringMap{
+		"ca.crt": caCert.CertPem,
+	})
+	if err != nil {
+		return pulumi.StringOutput{}, noCASecret, err
+	}
+
+	return secret.Metadata.Name().Elem(), caSecret.Metadata.Name().Elem(), nil
+}
+
+// requestCertificate requests the certificate from cert-manager and stores the CA certificate of the issuer in
+// keycloak-tls-ca.
+func requestCertificate(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+) (pulumi.StringOutput, pulumi.StringOutput, error) {
+	cert, err := certmanager.NewCertificate(
+		ctx,
+		"keycloak-tls",
+		args.TLS.Issuer,
+		&certmanager.CertificateArgs{
+			Namespace:  args.Namespace.Metadata.Name().Elem(),
+			SecretName: issuedSecretName,
+			CommonName: pulumi.String(args.Hostname),
+			DNSNames:   dnsNames(args.Hostname, args.Namespace.Metadata.Name().Elem()),
+		},
+		pulumi.Parent(component),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, pulumi.StringOutput{}, err
+	}
+
+	caSecret, err := newTLSSecret(ctx, component, args, tlsCASecretName, "Opaque", pulumi.StringMap{
+		"ca.crt": args.TLS.Issuer.CACert,
+	})
+	if err != nil {
+		return pulumi.StringOutput{}, pulumi.StringOutput{}, err
+	}
+
+	// Deriving the name from the certificate makes the Keycloak cluster wait until it has been requested.
+	secretName := cert.Metadata.Name().ApplyT(func(_ *string) string {
+		return issuedSecretName
+	}).(pulumi.StringOutput)
+
+	return secretName, caSecret.Metadata.Name().Elem(), nil
+}
+
+// dnsNames returns the names under which Keycloak is reachable: the configured hostname and the service.
+func dnsNames(hostname string, namespace pulumi.StringOutput) pulumi.StringArray {
+	names := pulumi.StringArray{pulumi.String(hostname)}
+	if hostname != serviceName {
+		names = append(names, pulumi.String(serviceName))
+	}
+
+	return append(names,
+		pulumi.Sprintf("%s.%s", serviceName, namespace),
+		pulumi.Sprintf("%s.%s.svc", serviceName, namespace),
+		pulumi.Sprintf("%s.%s.svc.cluster.local", serviceName, namespace),
+	)
+}
+
+// checkCertificate returns an error if certPEM does not start with a PEM encoded certificate that is valid for
+// hostname.
+func checkCertificate(certPEM string, hostname string) error {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("not a PEM encoded certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	return cert.VerifyHostname(hostname)
+}
+
+func newTLSSecret(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+	name string,
+	secretType string,
+	data pulumi.StringMap,
+) (*pulumiv1.Secret, error) {
+	return pulumiv1.NewSecret(
+		ctx,
+		name,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(name),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			Type:       pulumi.String(secretType),
+			StringData: data,
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
@@ -0,0 +1,48 @@
+package keycloak
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func selfSignedCert(t *testing.T, dnsNames ...string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCheckCertificate(t *testing.T) {
+	cert := selfSignedCert(t, "keycloak.example.org", "keycloak-service")
+
+	if err := checkCertificate(cert, "keycloak.example.org"); err != nil {
+		t.Errorf("expected the certificate to be valid for its DNS name: %v", err)
+	}
+	if err := checkCertificate(cert, "auth.example.org"); err == nil {
+		t.Error("expected an error for a hostname the certificate is not valid for")
+	}
+	if err := checkCertificate("not a certificate", "keycloak.example.org"); err == nil {
+		t.Error("expected an error for a value that is not PEM encoded")
+	}
+}
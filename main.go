@@ -1,6 +1,8 @@
 package main
 
 import (
+	"github.com/haikoschol/ort-server-pulumi-go/certmanager"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
 	"github.com/haikoschol/ort-server-pulumi-go/keycloak"
 	ortserver "github.com/haikoschol/ort-server-pulumi-go/ort-server"
 	"github.com/haikoschol/ort-server-pulumi-go/postgresql"
@@ -26,31 +28,130 @@ func main() {
 			return err
 		}
 
-		_, err = vault.NewCluster(ctx, "vault-cluster", &vault.ClusterArgs{Namespace: namespace})
+		// Vault and PostgreSQL read the outputs of the last update, which requires a single reference to this stack.
+		stack, err := common.NewSelfReference(ctx)
 		if err != nil {
 			return err
 		}
 
-		_, err = postgresql.NewCluster(ctx, "cnpg-cluster", &postgresql.ClusterArgs{Namespace: namespace})
+		certManagerArgs, err := certmanager.LoadArgs(ctx, namespace)
 		if err != nil {
 			return err
 		}
 
-		_, err = keycloak.NewCluster(ctx, "keycloak-cluster", &keycloak.ClusterArgs{Namespace: namespace})
+		// Without cert-manager, the components create their certificates themselves.
+		var issuer *certmanager.Issuer
+		if certManagerArgs != nil {
+			certManager, err := certmanager.NewCertManager(ctx, "cert-manager", certManagerArgs)
+			if err != nil {
+				return err
+			}
+			issuer = certManager.Issuer
+		}
+
+		vaultArgs, err := vault.LoadClusterArgs(ctx, namespace)
+		if err != nil {
+			return err
+		}
+
+		vaultArgs.Stack = stack
+		if vaultArgs.TLS != nil {
+			vaultArgs.TLS.Issuer = issuer
+		}
+
+		vaultCluster, err := vault.NewCluster(ctx, "vault-cluster", vaultArgs)
+		if err != nil {
+			return err
+		}
+
+		postgresqlArgs, err := postgresql.LoadClusterArgs(ctx, namespace)
+		if err != nil {
+			return err
+		}
+
+		postgresqlArgs.Stack = stack
+		postgresqlArgs.EnsureDatabase(postgresql.DatabaseArgs{Name: "keycloak"})
+
+		postgresqlCluster, err := postgresql.NewCluster(ctx, "cnpg-cluster", postgresqlArgs)
+		if err != nil {
+			return err
+		}
+
+		keycloakArgs, err := keycloak.LoadClusterArgs(ctx, namespace)
+		if err != nil {
+			return err
+		}
+
+		keycloakArgs.TLS.Issuer = issuer
+
+		keycloakDatabase := postgresqlCluster.Databases["keycloak"]
+		keycloakArgs.Database = keycloak.DatabaseArgs{
+			Host:       postgresqlCluster.PoolerHost,
+			Port:       postgresqlCluster.Port,
+			Name:       keycloakDatabase.Name,
+			SecretName: keycloakDatabase.SecretName,
+		}
+
+		keycloakCluster, err := keycloak.NewCluster(ctx, "keycloak-cluster", keycloakArgs)
+		if err != nil {
+			return err
+		}
+
+		rabbitmqArgs, err := rabbitmq.LoadClusterArgs(ctx, namespace)
 		if err != nil {
 			return err
 		}
 
-		_, err = rabbitmq.NewCluster(ctx, "rabbitmq-cluster", &rabbitmq.ClusterArgs{Namespace: namespace})
+		rabbitmqArgs.Issuer = issuer
+
+		rabbitmqCluster, err := rabbitmq.NewCluster(ctx, "rabbitmq-cluster", rabbitmqArgs)
 		if err != nil {
 			return err
 		}
 
-		_, err = ortserver.NewORTServer(ctx, "ort-server", &ortserver.Args{Namespace: namespace})
+		ortServerArgs, err := ortserver.LoadArgs(ctx, namespace)
 		if err != nil {
 			return err
 		}
 
+		ortServerArgs.Database = ortserver.DatabaseArgs{
+			SecretName: postgresqlCluster.AppSecretName,
+			Host:       postgresqlCluster.PoolerHost,
+		}
+		ortServerArgs.RabbitMQ = ortserver.RabbitMQArgs{
+			URI:        rabbitmqCluster.URI,
+			SecretName: rabbitmqCluster.DefaultUserSecretName,
+		}
+		if rabbitmqArgs.Issuer != nil {
+			ortServerArgs.RabbitMQ.URI = rabbitmqCluster.TLSURI
+			ortServerArgs.RabbitMQ.CASecretName = rabbitmqCluster.CASecretName
+		}
+		ortServerArgs.Keycloak = ortserver.KeycloakArgs{
+			URL: keycloakCluster.URL,
+		}
+		if keycloakArgs.TLS.Cert == "" {
+			ortServerArgs.Keycloak.CASecretName = keycloakCluster.CASecretName
+		}
+
+		if vaultCluster.ORTServerConfigured {
+			ortServerArgs.Vault = &ortserver.VaultArgs{
+				URI:        vaultCluster.Address,
+				Prefix:     vaultCluster.ORTServerMountPath,
+				SecretName: vaultCluster.ORTServerSecretName,
+			}
+			if vaultArgs.TLS != nil {
+				ortServerArgs.Vault.CASecretName = vaultCluster.CASecretName
+			}
+		}
+
+		ortServer, err := ortserver.NewORTServer(ctx, "ort-server", ortServerArgs)
+		if err != nil {
+			return err
+		}
+
+		ctx.Export("vault-address", vaultCluster.Address)
+		ctx.Export("ort-server-url", ortServer.CoreURL)
+
 		return nil
 	})
 }
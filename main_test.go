@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/haikoschol/ort-server-pulumi-go/postgresql"
+	"github.com/haikoschol/ort-server-pulumi-go/vault"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimeta1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"sync"
+	"testing"
+)
+
+// mocks fails the registration of a resource whose type, name and parent match an earlier one, like the engine does
+// for duplicate URNs.
+type mocks struct {
+	mu   sync.Mutex
+	urns map[string]bool
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	parent := args.RegisterRPC.GetParent()
+	if args.ReadRPC != nil {
+		parent = args.ReadRPC.GetParent()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	urn := fmt.Sprintf("%s::%s::%s", parent, args.TypeToken, args.Name)
+	if m.urns[urn] {
+		return "", nil, fmt.Errorf("duplicate resource URN %s", urn)
+	}
+	m.urns[urn] = true
+
+	if args.TypeToken == "pulumi:pulumi:StackReference" {
+		// A new stack without outputs.
+		return args.Name, resource.NewPropertyMapFromMap(map[string]interface{}{
+			"name":              args.Name,
+			"outputs":           map[string]interface{}{},
+			"secretOutputNames": []interface{}{},
+		}), nil
+	}
+
+	return args.Name + "_id", args.Inputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	if args.Token == "kubernetes:yaml:decode" {
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"result": []interface{}{}}), nil
+	}
+	return args.Args, nil
+}
+
+// TestSharedStackReference deploys the components that read the outputs of the last update side by side, as main does.
+func TestSharedStackReference(t *testing.T) {
+	m := &mocks{urns: make(map[string]bool)}
+	preview := func(info *pulumi.RunInfo) { info.DryRun = true }
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		namespace, err := pulumiv1.NewNamespace(ctx, "ort-server", &pulumiv1.NamespaceArgs{
+			Metadata: &pulumimeta1.ObjectMetaArgs{
+				Name: pulumi.String("ort-server"),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		stack, err := common.NewSelfReference(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = vault.NewCluster(ctx, "vault-cluster", &vault.ClusterArgs{
+			Namespace:    namespace,
+			Stack:        stack,
+			ChartVersion: "0.28.0",
+			ImageTag:     "1.16.1",
+			Replicas:     3,
+			ClusterName:  "vault",
+			KeyShares:    5,
+			KeyThreshold: 3,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = postgresql.NewCluster(ctx, "cnpg-cluster", &postgresql.ClusterArgs{
+			Namespace:    namespace,
+			Stack:        stack,
+			MajorVersion: 16,
+			ImageName:    "ghcr.io/cloudnative-pg/postgresql:16.3",
+			Instances:    1,
+			StorageSize:  "1Gi",
+		})
+		return err
+	}, pulumi.WithMocks("project", "stack", m), preview)
+
+	if err != nil {
+		t.Fatalf("deploying Vault and PostgreSQL returned an unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package ortserver
+
+import (
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const imageRepository = "ghcr.io/eclipse-apoapsis"
+
+// LoadArgs reads the "ortServer:*" keys from the stack configuration. Images default to the ones published for
+// "ortServer:imageTag", but can be overridden individually, e.g. with "ortServer:coreImage". Every component also reads
+// "<component>Replicas", "<component>Resources" (an object with cpuRequest, cpuLimit, memoryRequest and memoryLimit)
+// and "<component>Env" (an object mapping variable names to values). Workers are configured with objects like
+// "ortServer:analyzerWorker", whose fields are described by WorkerArgs. Setting "enabled" to false in such an object
+// removes the worker. "ortServer:kubectlImage" is the image publishing the trust store for the worker Jobs.
+func LoadArgs(ctx *pulumi.Context, namespace *pulumiv1.Namespace) (*Args, error) {
+	cfg := common.NewConfig(ctx, "ortServer")
+
+	imageTag := cfg.String("imageTag", "sha-523cacc")
+	cfg.NotEmpty("imageTag", imageTag)
+
+	args := &Args{
+		Namespace:    namespace,
+		Core:         loadComponentArgs(cfg, "core", "ort-server-core", imageTag),
+		Orchestrator: loadComponentArgs(cfg, "orchestrator", "ort-server-orchestrator", imageTag),
+		ServiceType:  cfg.String("serviceType", "LoadBalancer"),
+		KubectlImage: cfg.String("kubectlImage", "bitnami/kubectl:1.30.2"),
+	}
+
+	for _, name := range workerNames {
+		if worker, enabled := loadWorkerArgs(cfg, name, imageTag); enabled {
+			args.Workers = append(args.Workers, worker)
+		}
+	}
+
+	cfg.Object("env", &args.Env)
+	cfg.OneOf("serviceType", args.ServiceType, "ClusterIP", "NodePort", "LoadBalancer")
+	cfg.NotEmpty("kubectlImage", args.KubectlImage)
+
+	return args, cfg.Err()
+}
+
+func loadComponentArgs(cfg *common.Config, key string, imageName string, imageTag string) ComponentArgs {
+	args := ComponentArgs{
+		Image:    cfg.String(key+"Image", image(imageName, imageTag)),
+		Replicas: cfg.Int(key+"Replicas", 1),
+	}
+
+	cfg.Object(key+"Resources", &args.Resources)
+	cfg.Object(key+"Env", &args.Env)
+
+	cfg.NotEmpty(key+"Image", args.Image)
+	cfg.Positive(key+"Replicas", args.Replicas)
+	validateResources(cfg, key+"Resources", args.Resources)
+
+	return args
+}
+
+func loadWorkerArgs(cfg *common.Config, name string, imageTag string) (WorkerArgs, bool) {
+	key := name + "Worker"
+	worker := struct {
+		WorkerArgs
+		Enabled bool `json:"enabled"`
+	}{
+		WorkerArgs: WorkerArgs{
+			Name:      name,
+			Image:     image(fmt.Sprintf("ort-server-%s-worker", name), imageTag),
+			Transport: TransportKubernetes,
+			QueueName: name + "_queue",
+			Replicas:  1,
+		},
+		Enabled: true,
+	}
+
+	cfg.Object(key, &worker)
+
+	cfg.NotEmpty(key+".image", worker.Image)
+	cfg.OneOf(key+".transport", worker.Transport, TransportKubernetes, TransportRabbitMQ)
+	if worker.Transport == TransportRabbitMQ {
+		cfg.NotEmpty(key+".queueName", worker.QueueName)
+		cfg.Positive(key+".replicas", worker.Replicas)
+	}
+	validateResources(cfg, key+".resources", worker.Resources)
+
+	return worker.WorkerArgs, worker.Enabled
+}
+
+func validateResources(cfg *common.Config, key string, r Resources) {
+	for _, q := range []string{r.CPURequest, r.CPULimit, r.MemoryRequest, r.MemoryLimit} {
+		if q != "" {
+			cfg.Quantity(key, q)
+		}
+	}
+}
+
+func image(name string, tag string) string {
+	return imageRepository + "/" + name + ":" + tag
+}
@@ -0,0 +1,115 @@
+package ortserver
+
+import (
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"sort"
+)
+
+func databaseEnv(args *Args) []pulumiv1.EnvVarArgs {
+	secretName := args.Database.SecretName
+	host := secretEnv("DB_HOST", secretName, "host")
+	if args.Database.Host != nil {
+		host = inputEnv("DB_HOST", args.Database.Host)
+	}
+
+	return []pulumiv1.EnvVarArgs{
+		host,
+		secretEnv("DB_PORT", secretName, "port"),
+		secretEnv("DB_NAME", secretName, "dbname"),
+		valueEnv("DB_SCHEMA", "public"),
+		secretEnv("DB_USERNAME", secretName, "username"),
+		secretEnv("DB_PASSWORD", secretName, "password"),
+		valueEnv("DB_SSL_MODE", "require"),
+	}
+}
+
+func keycloakEnv(args *Args) []pulumiv1.EnvVarArgs {
+	return []pulumiv1.EnvVarArgs{
+		inputEnv("JWT_URI", pulumi.Sprintf("%s/realms/master/protocol/openid-connect/certs", args.Keycloak.URL)),
+		inputEnv("JWT_ISSUER", pulumi.Sprintf("%s/realms/master", args.Keycloak.URL)),
+	}
+}
+
+// rabbitMQEnv returns the variables configuring a RabbitMQ transport endpoint, e.g. "ORCHESTRATOR_SENDER".
+func rabbitMQEnv(args *Args, prefix string, queueName string) []pulumiv1.EnvVarArgs {
+	return []pulumiv1.EnvVarArgs{
+		valueEnv(prefix+"_TRANSPORT_TYPE", "rabbitMQ"),
+		inputEnv(prefix+"_TRANSPORT_SERVER_URI", args.RabbitMQ.URI),
+		valueEnv(prefix+"_TRANSPORT_QUEUE_NAME", queueName),
+		secretEnv(prefix+"_TRANSPORT_USERNAME", args.RabbitMQ.SecretName, "username"),
+		secretEnv(prefix+"_TRANSPORT_PASSWORD", args.RabbitMQ.SecretName, "password"),
+	}
+}
+
+// vaultEnv returns the variables configuring the Vault secrets provider, or nil if Vault is not used.
+func vaultEnv(args *Args) []pulumiv1.EnvVarArgs {
+	if args.Vault == nil {
+		return nil
+	}
+
+	return []pulumiv1.EnvVarArgs{
+		valueEnv("SECRETS_PROVIDER_NAME", "vault"),
+		inputEnv("VAULT_URI", args.Vault.URI),
+		inputEnv("VAULT_PREFIX", args.Vault.Prefix),
+		secretEnv("VAULT_ROLE_ID", args.Vault.SecretName, "role-id"),
+		secretEnv("VAULT_SECRET_ID", args.Vault.SecretName, "secret-id"),
+	}
+}
+
+func valueEnv(name string, value string) pulumiv1.EnvVarArgs {
+	return inputEnv(name, pulumi.String(value))
+}
+
+func inputEnv(name string, value pulumi.StringInput) pulumiv1.EnvVarArgs {
+	return pulumiv1.EnvVarArgs{
+		Name:  pulumi.String(name),
+		Value: value,
+	}
+}
+
+func secretEnv(name string, secretName pulumi.StringInput, key string) pulumiv1.EnvVarArgs {
+	return pulumiv1.EnvVarArgs{
+		Name: pulumi.String(name),
+		ValueFrom: pulumiv1.EnvVarSourceArgs{
+			SecretKeyRef: pulumiv1.SecretKeySelectorArgs{
+				Name: secretName,
+				Key:  pulumi.String(key),
+			},
+		},
+	}
+}
+
+// mergeEnv replaces generated variables with the ones from overrides, in order, and appends the remaining overrides
+// sorted by name.
+func mergeEnv(env []pulumiv1.EnvVarArgs, overrides ...map[string]string) pulumiv1.EnvVarArray {
+	merged := make(map[string]string)
+	for _, o := range overrides {
+		for name, value := range o {
+			merged[name] = value
+		}
+	}
+
+	result := make(pulumiv1.EnvVarArray, 0, len(env)+len(merged))
+	for _, e := range env {
+		name := string(e.Name.(pulumi.String))
+		if value, ok := merged[name]; ok {
+			result = append(result, valueEnv(name, value))
+			delete(merged, name)
+		} else {
+			result = append(result, e)
+		}
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		result = append(result, valueEnv(name, merged[name]))
+	}
+
+	return result
+}
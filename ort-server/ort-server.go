@@ -1,49 +1,444 @@
 package ortserver
 
 import (
-	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
-	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiappsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	pulumibatchv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/batch/v1"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	pulumirbacv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/rbac/v1"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+const (
+	// CoreServiceAccountName and OrchestratorServiceAccountName are the service accounts of the core and the
+	// orchestrator.
+	CoreServiceAccountName         = "ort-server-core"
+	OrchestratorServiceAccountName = "orchestrator"
+
+	// legacyType is the type the component was registered with when the core and the orchestrator were created from
+	// core.yaml and orchestrator.yaml.
+	legacyType = "rabbitmq:Cluster"
+)
+
 type ORTServer struct {
 	pulumi.ResourceState
 
-	coreManifest         *yaml.ConfigFile
-	orchestratorManifest *yaml.ConfigFile
+	// CoreServiceName is the name of the service exposing the ORT Server API.
+	CoreServiceName pulumi.StringOutput
+	CorePort        pulumi.IntOutput
+	// CoreURL is the base URL of the ORT Server API inside the cluster.
+	CoreURL pulumi.StringOutput
+
+	coreServiceAccount         *pulumiv1.ServiceAccount
+	coreDeployment             *pulumiappsv1.Deployment
+	coreService                *pulumiv1.Service
+	orchestratorServiceAccount *pulumiv1.ServiceAccount
+	orchestratorRole           *pulumirbacv1.Role
+	orchestratorRoleBinding    *pulumirbacv1.RoleBinding
+	orchestratorDeployment     *pulumiappsv1.Deployment
+	workerServiceAccount       *pulumiv1.ServiceAccount
+	workerConfigMaps           []*pulumiv1.ConfigMap
+	trustStoreSecret           *pulumiv1.Secret
+	trustStoreJob              *pulumibatchv1.Job
+	workerDeployments          []*pulumiappsv1.Deployment
+
+	// legacyURN is the URN the component had with legacyType, which the aliases of its former ConfigFiles refer to.
+	legacyURN pulumi.URNOutput
 }
 
 type Args struct {
-	Namespace *corev1.Namespace
+	Namespace    *pulumiv1.Namespace
+	Core         ComponentArgs
+	Orchestrator ComponentArgs
+	// ServiceType is the type of the Service exposing the core API, e.g. "LoadBalancer" or "ClusterIP".
+	ServiceType string
+	// Env contains environment variables for every ORT Server container. They take precedence over the generated ones.
+	Env map[string]string
+	// Workers configures the ORT Server workers. The orchestrator dispatches work only to the workers listed here.
+	Workers  []WorkerArgs
+	Database DatabaseArgs
+	RabbitMQ RabbitMQArgs
+	Keycloak KeycloakArgs
+	// Vault configures the Vault secrets provider of the core and the orchestrator if not nil.
+	Vault *VaultArgs
+	// KubectlImage is the image of the Job publishing the trust store for the worker Jobs. It needs a shell.
+	KubectlImage string
+}
+
+// DatabaseArgs describes the PostgreSQL database ORT Server stores its data in.
+type DatabaseArgs struct {
+	// SecretName is the name of a secret with the keys host, port, dbname, username and password.
+	SecretName pulumi.StringInput
+	// Host overrides the host from the secret if not nil, e.g. to connect through a connection pooler.
+	Host pulumi.StringInput
+}
+
+// RabbitMQArgs describes the message broker used for communication between the ORT Server components.
+type RabbitMQArgs struct {
+	URI pulumi.StringInput
+	// SecretName is the name of a secret with the keys username and password.
+	SecretName pulumi.StringInput
+	// CASecretName is the name of a secret with the key ca.crt, the CA certificate RabbitMQ's certificate is signed
+	// with. It is added to the Java trust store of the containers if not nil.
+	CASecretName pulumi.StringInput
+}
+
+// KeycloakArgs describes the identity provider issuing the tokens accepted by the ORT Server API.
+type KeycloakArgs struct {
+	URL pulumi.StringInput
+	// CASecretName is the name of a secret with the key ca.crt, the CA certificate Keycloak's certificate is signed
+	// with. It is added to the Java trust store of the containers if not nil.
+	CASecretName pulumi.StringInput
+}
+
+// VaultArgs describes the Vault secrets engine ORT Server stores secrets in.
+type VaultArgs struct {
+	URI pulumi.StringInput
+	// Prefix is the path of the KV v2 secrets engine.
+	Prefix pulumi.StringInput
+	// SecretName is the name of a secret with the keys role-id and secret-id of an AppRole.
+	SecretName pulumi.StringInput
+	// CASecretName is the name of a secret with the key ca.crt, the CA certificate Vault's certificate is signed with.
+	// It is added to the Java trust store of the containers if not nil.
+	CASecretName pulumi.StringInput
+}
+
+// ComponentArgs describes a single ORT Server Deployment.
+type ComponentArgs struct {
+	Image     string
+	Replicas  int
+	Resources Resources
+	// Env contains environment variables for this component. They take precedence over Args.Env.
+	Env map[string]string
+}
+
+// Resources holds the compute resources of a container. Empty values are omitted.
+type Resources struct {
+	CPURequest    string `json:"cpuRequest"`
+	CPULimit      string `json:"cpuLimit"`
+	MemoryRequest string `json:"memoryRequest"`
+	MemoryLimit   string `json:"memoryLimit"`
 }
 
 func NewORTServer(ctx *pulumi.Context, name string, args *Args, opts ...pulumi.ResourceOption) (*ORTServer, error) {
 	component := &ORTServer{}
-	opts = append(opts, pulumi.DependsOn([]pulumi.Resource{args.Namespace}))
-	err := ctx.RegisterComponentResource("rabbitmq:Cluster", name, component, opts...)
+	opts = append(opts,
+		pulumi.DependsOn([]pulumi.Resource{args.Namespace}),
+		pulumi.Aliases([]pulumi.Alias{{Type: pulumi.String(legacyType)}}),
+	)
+	err := ctx.RegisterComponentResource("ortserver:ORTServer", name, component, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	component.legacyURN = pulumi.CreateURN(pulumi.String(name), pulumi.String(legacyType), nil,
+		pulumi.String(ctx.Project()), pulumi.String(ctx.Stack()))
+
+	err = createCore(ctx, component, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = createWorkers(ctx, component, args)
+	if err != nil {
+		return nil, err
+	}
+
+	err = createOrchestrator(ctx, component, args)
+	if err != nil {
+		return nil, err
+	}
+
+	component.CoreServiceName = component.coreService.Metadata.Name().Elem()
+	component.CorePort = pulumi.Int(8080).ToIntOutput()
+	component.CoreURL = pulumi.Sprintf("http://%s:%d", component.CoreServiceName, component.CorePort)
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"coreServiceName": component.CoreServiceName,
+		"corePort":        component.CorePort,
+		"coreURL":         component.CoreURL,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	component.coreManifest, err = yaml.NewConfigFile(ctx, "ort-server-core",
-		&yaml.ConfigFileArgs{
-			File: "./ort-server/core.yaml",
+	return component, nil
+}
+
+func createCore(ctx *pulumi.Context, component *ORTServer, args *Args) error {
+	var err error
+	component.coreServiceAccount, err = pulumiv1.NewServiceAccount(
+		ctx,
+		CoreServiceAccountName,
+		&pulumiv1.ServiceAccountArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(CoreServiceAccountName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
 		},
 		pulumi.ResourceOption(pulumi.Parent(component)),
 	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	env := append(databaseEnv(args), keycloakEnv(args)...)
+	env = append(env, pulumiv1.EnvVarArgs{Name: pulumi.String("PORT"), Value: pulumi.String("8080")})
+	env = append(env, rabbitMQEnv(args, "ORCHESTRATOR_SENDER", "orchestrator_queue")...)
+	env = append(env, vaultEnv(args)...)
+
+	container := pulumiv1.ContainerArgs{
+		Name:      pulumi.String("ort-server"),
+		Image:     pulumi.String(args.Core.Image),
+		Env:       mergeEnv(env, args.Env, args.Core.Env),
+		Resources: args.Core.Resources.toResourceRequirements(),
+		Ports: pulumiv1.ContainerPortArray{
+			pulumiv1.ContainerPortArgs{
+				ContainerPort: pulumi.Int(8080),
+			},
+		},
+		LivenessProbe: pulumiv1.ProbeArgs{
+			FailureThreshold: pulumi.Int(6),
+			HttpGet: pulumiv1.HTTPGetActionArgs{
+				Path:   pulumi.String("/api/v1/liveness"),
+				Port:   pulumi.Int(8080),
+				Scheme: pulumi.String("HTTP"),
+			},
+			PeriodSeconds:    pulumi.Int(10),
+			SuccessThreshold: pulumi.Int(1),
+			TimeoutSeconds:   pulumi.Int(5),
+		},
+	}
+
+	component.coreDeployment, err = newDeployment(
+		ctx,
+		component,
+		args,
+		"ort-server-core",
+		args.Core.Replicas,
+		container,
+		component.coreServiceAccount.Metadata.Name(),
+		component.legacyAlias(ctx, "ort-server-core", "ort-server-core"),
+	)
+	if err != nil {
+		return err
 	}
 
-	component.orchestratorManifest, err = yaml.NewConfigFile(ctx, "ort-server-orchestrator",
-		&yaml.ConfigFileArgs{
-			File: "./ort-server/orchestrator.yaml",
+	component.coreService, err = pulumiv1.NewService(
+		ctx,
+		"ort-server-core",
+		&pulumiv1.ServiceArgs{
+			Metadata: metadata(args, "ort-server-core"),
+			Spec: pulumiv1.ServiceSpecArgs{
+				Type: pulumi.String(args.ServiceType),
+				Ports: pulumiv1.ServicePortArray{
+					pulumiv1.ServicePortArgs{
+						Name:       pulumi.String("http"),
+						Port:       pulumi.Int(8080),
+						TargetPort: pulumi.Int(8080),
+					},
+				},
+				Selector: selector("ort-server-core"),
+			},
 		},
 		pulumi.ResourceOption(pulumi.Parent(component)),
+		component.legacyAlias(ctx, "ort-server-core", "ort-server-core"),
+	)
+	return err
+}
+
+func createOrchestrator(ctx *pulumi.Context, component *ORTServer, args *Args) error {
+	var err error
+	component.orchestratorServiceAccount, err = pulumiv1.NewServiceAccount(
+		ctx,
+		OrchestratorServiceAccountName,
+		&pulumiv1.ServiceAccountArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(OrchestratorServiceAccountName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+		component.legacyAlias(ctx, "ort-server-orchestrator", OrchestratorServiceAccountName),
 	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	component.orchestratorRole, err = pulumirbacv1.NewRole(
+		ctx,
+		"job-creator",
+		&pulumirbacv1.RoleArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String("job-creator"),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			Rules: pulumirbacv1.PolicyRuleArray{
+				pulumirbacv1.PolicyRuleArgs{
+					ApiGroups: pulumi.ToStringArray([]string{"batch", "extensions"}),
+					Resources: pulumi.ToStringArray([]string{"jobs"}),
+					Verbs:     pulumi.ToStringArray([]string{"create", "get", "list", "watch", "delete"}),
+				},
+				// Needed to inspect and clean up the pods of failed worker jobs.
+				pulumirbacv1.PolicyRuleArgs{
+					ApiGroups: pulumi.ToStringArray([]string{""}),
+					Resources: pulumi.ToStringArray([]string{"pods"}),
+					Verbs:     pulumi.ToStringArray([]string{"get", "list", "watch", "delete"}),
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+		component.legacyAlias(ctx, "ort-server-orchestrator", "job-creator"),
+	)
+	if err != nil {
+		return err
+	}
+
+	component.orchestratorRoleBinding, err = pulumirbacv1.NewRoleBinding(
+		ctx,
+		"job-creator",
+		&pulumirbacv1.RoleBindingArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String("job-creator"),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			Subjects: pulumirbacv1.SubjectArray{
+				pulumirbacv1.SubjectArgs{
+					Kind:      pulumi.String("ServiceAccount"),
+					Name:      component.orchestratorServiceAccount.Metadata.Name().Elem(),
+					Namespace: args.Namespace.Metadata.Name(),
+				},
+			},
+			RoleRef: pulumirbacv1.RoleRefArgs{
+				Kind:     pulumi.String("Role"),
+				Name:     component.orchestratorRole.Metadata.Name().Elem(),
+				ApiGroup: pulumi.String("rbac.authorization.k8s.io"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+		component.legacyAlias(ctx, "ort-server-orchestrator", "job-creator"),
+	)
+	if err != nil {
+		return err
+	}
+
+	env := databaseEnv(args)
+	env = append(env, rabbitMQEnv(args, "ORCHESTRATOR_SENDER", "orchestrator_queue")...)
+	env = append(env, rabbitMQEnv(args, "ORCHESTRATOR_RECEIVER", "orchestrator_queue")...)
+	env = append(env, workerSenderEnv(args)...)
+	env = append(env, vaultEnv(args)...)
+
+	container := pulumiv1.ContainerArgs{
+		Name:      pulumi.String("orchestrator"),
+		Image:     pulumi.String(args.Orchestrator.Image),
+		Env:       mergeEnv(env, args.Env, args.Orchestrator.Env),
+		Resources: args.Orchestrator.Resources.toResourceRequirements(),
+	}
+
+	opts := []pulumi.ResourceOption{component.legacyAlias(ctx, "ort-server-orchestrator", "ort-server-orchestrator")}
+	if usesTrustStore(args) {
+		err = createTrustStoreSecret(ctx, component, args)
+		if err != nil {
+			return err
+		}
+		// The worker Jobs started by the orchestrator mount the trust store published by the Job.
+		opts = append(opts, pulumi.DependsOn([]pulumi.Resource{component.trustStoreJob}))
+	}
+
+	component.orchestratorDeployment, err = newDeployment(
+		ctx,
+		component,
+		args,
+		"ort-server-orchestrator",
+		args.Orchestrator.Replicas,
+		container,
+		component.orchestratorServiceAccount.Metadata.Name(),
+		opts...,
+	)
+	return err
+}
+
+func newDeployment(
+	ctx *pulumi.Context,
+	component *ORTServer,
+	args *Args,
+	name string,
+	replicas int,
+	container pulumiv1.ContainerArgs,
+	serviceAccountName pulumi.StringPtrInput,
+	opts ...pulumi.ResourceOption,
+) (*pulumiappsv1.Deployment, error) {
+	spec := pulumiv1.PodSpecArgs{
+		ServiceAccountName: serviceAccountName,
+		RestartPolicy:      pulumi.String("Always"),
+	}
+	if usesTrustStore(args) {
+		addTrustStore(&spec, &container, trustedCAs(args))
+	}
+	spec.Containers = pulumiv1.ContainerArray{container}
+
+	return pulumiappsv1.NewDeployment(
+		ctx,
+		name,
+		&pulumiappsv1.DeploymentArgs{
+			Metadata: metadata(args, name),
+			Spec: pulumiappsv1.DeploymentSpecArgs{
+				Replicas: pulumi.Int(replicas),
+				Selector: pulumimetav1.LabelSelectorArgs{
+					MatchLabels: selector(name),
+				},
+				Template: pulumiv1.PodTemplateSpecArgs{
+					Metadata: pulumimetav1.ObjectMetaArgs{
+						Labels: selector(name),
+					},
+					Spec: spec,
+				},
+			},
+		},
+		append(opts, pulumi.Parent(component))...,
+	)
+}
+
+// legacyAlias returns the alias of a resource that used to be created from the ConfigFile configFile of the component.
+// The object is in the namespace "ort-server" the YAML files were written for.
+func (c *ORTServer) legacyAlias(ctx *pulumi.Context, configFile string, object string) pulumi.ResourceOption {
+	return pulumi.Aliases([]pulumi.Alias{common.ConfigFileAlias(ctx, c.legacyURN, configFile, "ort-server/"+object)})
+}
+
+func metadata(args *Args, name string) pulumimetav1.ObjectMetaArgs {
+	return pulumimetav1.ObjectMetaArgs{
+		Name:      pulumi.String(name),
+		Namespace: args.Namespace.Metadata.Name(),
+		Labels:    selector(name),
+	}
+}
+
+func selector(name string) pulumi.StringMap {
+	return pulumi.StringMap{
+		"app": pulumi.String(name),
+	}
+}
+
+func (r Resources) toResourceRequirements() pulumiv1.ResourceRequirementsArgs {
+	requests := pulumi.StringMap{}
+	limits := pulumi.StringMap{}
+
+	if r.CPURequest != "" {
+		requests["cpu"] = pulumi.String(r.CPURequest)
+	}
+	if r.MemoryRequest != "" {
+		requests["memory"] = pulumi.String(r.MemoryRequest)
+	}
+	if r.CPULimit != "" {
+		limits["cpu"] = pulumi.String(r.CPULimit)
+	}
+	if r.MemoryLimit != "" {
+		limits["memory"] = pulumi.String(r.MemoryLimit)
 	}
 
-	return nil, nil
+	return pulumiv1.ResourceRequirementsArgs{
+		Requests: requests,
+		Limits:   limits,
+	}
 }
@@ -0,0 +1,407 @@
+package ortserver
+
+import (
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type mocks struct {
+	mu        sync.Mutex
+	resources map[string]map[string]interface{}
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources[args.TypeToken+"::"+args.Name] = args.Inputs.Mappable()
+	return args.Name + "_id", args.Inputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+// run creates an ORTServer with the given args and returns the inputs of all registered resources, keyed by
+// "<type>::<name>".
+func run(t *testing.T, args Args) map[string]map[string]interface{} {
+	m := &mocks{resources: make(map[string]map[string]interface{})}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		namespace, err := pulumiv1.NewNamespace(ctx, "ort-server", &pulumiv1.NamespaceArgs{
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name: pulumi.String("ort-server"),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		args.Namespace = namespace
+		_, err = NewORTServer(ctx, "ort-server", &args)
+		return err
+	}, pulumi.WithMocks("project", "stack", m))
+
+	if err != nil {
+		t.Fatalf("NewORTServer() returned an unexpected error: %v", err)
+	}
+
+	return m.resources
+}
+
+func testArgs() Args {
+	return Args{
+		Core: ComponentArgs{
+			Image:    "ort-server-core:1.0",
+			Replicas: 2,
+			Resources: Resources{
+				CPURequest:  "500m",
+				MemoryLimit: "2Gi",
+			},
+			Env: map[string]string{
+				"DB_SCHEMA": "ort",
+				"LOG_LEVEL": "debug",
+			},
+		},
+		Orchestrator: ComponentArgs{
+			Image:    "ort-server-orchestrator:1.0",
+			Replicas: 1,
+		},
+		ServiceType: "ClusterIP",
+		Database: DatabaseArgs{
+			SecretName: pulumi.String("postgresql-app"),
+		},
+		RabbitMQ: RabbitMQArgs{
+			URI:        pulumi.String("amqp://rabbitmq:5672"),
+			SecretName: pulumi.String("rabbitmq-default-user"),
+		},
+		Keycloak: KeycloakArgs{
+			URL: pulumi.String("https://keycloak-service:8443"),
+		},
+		Workers: []WorkerArgs{
+			{
+				Name:      "analyzer",
+				Image:     "ort-server-analyzer-worker:1.0",
+				Transport: TransportKubernetes,
+				Resources: Resources{
+					MemoryLimit: "8Gi",
+				},
+				Env: map[string]string{
+					"JAVA_OPTS": "-Xmx6g",
+				},
+			},
+			{
+				Name:      "reporter",
+				Image:     "ort-server-reporter-worker:1.0",
+				Transport: TransportRabbitMQ,
+				QueueName: "reporter_queue",
+				Replicas:  3,
+			},
+		},
+		Env: map[string]string{
+			"DB_SCHEMA":   "ignored",
+			"DB_SSL_MODE": "disable",
+		},
+	}
+}
+
+func lookup(t *testing.T, resources map[string]map[string]interface{}, key string) map[string]interface{} {
+	r, ok := resources[key]
+	if !ok {
+		t.Fatalf("expected resource %s to be registered", key)
+	}
+	return r
+}
+
+func podSpec(deployment map[string]interface{}) map[string]interface{} {
+	spec := deployment["spec"].(map[string]interface{})
+	return spec["template"].(map[string]interface{})["spec"].(map[string]interface{})
+}
+
+func container(deployment map[string]interface{}) map[string]interface{} {
+	return podSpec(deployment)["containers"].([]interface{})[0].(map[string]interface{})
+}
+
+func env(container map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, e := range container["env"].([]interface{}) {
+		v := e.(map[string]interface{})
+		result[v["name"].(string)] = v
+	}
+	return result
+}
+
+func TestCoreDeployment(t *testing.T) {
+	resources := run(t, testArgs())
+	deployment := lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-core")
+
+	replicas := deployment["spec"].(map[string]interface{})["replicas"]
+	if replicas != 2.0 {
+		t.Fatalf("expected 2 replicas, got %v", replicas)
+	}
+
+	c := container(deployment)
+	if c["image"] != "ort-server-core:1.0" {
+		t.Fatalf("expected image ort-server-core:1.0, got %v", c["image"])
+	}
+
+	requests := c["resources"].(map[string]interface{})["requests"].(map[string]interface{})
+	if requests["cpu"] != "500m" {
+		t.Fatalf("expected cpu request 500m, got %v", requests["cpu"])
+	}
+	if _, ok := requests["memory"]; ok {
+		t.Fatalf("expected no memory request, got %v", requests["memory"])
+	}
+
+	vars := env(c)
+	expected := map[string]string{
+		"DB_SCHEMA":   "ort",
+		"DB_SSL_MODE": "disable",
+		"LOG_LEVEL":   "debug",
+		"PORT":        "8080",
+		"JWT_ISSUER":  "https://keycloak-service:8443/realms/master",
+		"ORCHESTRATOR_SENDER_TRANSPORT_SERVER_URI": "amqp://rabbitmq:5672",
+	}
+	for name, value := range expected {
+		v, ok := vars[name]
+		if !ok {
+			t.Fatalf("expected environment variable %s to be set", name)
+		}
+		if actual := v.(map[string]interface{})["value"]; actual != value {
+			t.Fatalf("expected environment variable %s to be %s, got %v", name, value, actual)
+		}
+	}
+
+	if _, ok := vars["DB_PASSWORD"].(map[string]interface{})["valueFrom"]; !ok {
+		t.Fatalf("expected DB_PASSWORD to be read from a secret")
+	}
+}
+
+func TestCoreService(t *testing.T) {
+	resources := run(t, testArgs())
+	service := lookup(t, resources, "kubernetes:core/v1:Service::ort-server-core")
+
+	serviceType := service["spec"].(map[string]interface{})["type"]
+	if serviceType != "ClusterIP" {
+		t.Fatalf("expected service type ClusterIP, got %v", serviceType)
+	}
+}
+
+func TestOrchestratorDeployment(t *testing.T) {
+	resources := run(t, testArgs())
+	deployment := lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-orchestrator")
+
+	serviceAccount := podSpec(deployment)["serviceAccountName"]
+	if serviceAccount != "orchestrator" {
+		t.Fatalf("expected service account orchestrator, got %v", serviceAccount)
+	}
+
+	vars := env(container(deployment))
+	if _, ok := vars["ORCHESTRATOR_RECEIVER_TRANSPORT_QUEUE_NAME"]; !ok {
+		t.Fatalf("expected the orchestrator to receive messages from RabbitMQ")
+	}
+	if vars["DB_SCHEMA"].(map[string]interface{})["value"] != "ignored" {
+		t.Fatalf("expected global environment overrides to apply to the orchestrator")
+	}
+
+	lookup(t, resources, "kubernetes:rbac.authorization.k8s.io/v1:Role::job-creator")
+	lookup(t, resources, "kubernetes:rbac.authorization.k8s.io/v1:RoleBinding::job-creator")
+}
+
+func TestKubernetesWorker(t *testing.T) {
+	resources := run(t, testArgs())
+
+	if _, ok := resources["kubernetes:core/v1:ConfigMap::ort-server-analyzer-worker"]; ok {
+		t.Fatalf("expected no ConfigMap for a worker started as Kubernetes Job")
+	}
+	if _, ok := resources["kubernetes:apps/v1:Deployment::ort-server-analyzer-worker"]; ok {
+		t.Fatalf("expected no Deployment for a worker started as Kubernetes Job")
+	}
+
+	orchestrator := container(lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-orchestrator"))
+	vars := env(orchestrator)
+	expected := map[string]string{
+		"ANALYZER_SENDER_TRANSPORT_TYPE":            TransportKubernetes,
+		"ANALYZER_SENDER_TRANSPORT_NAMESPACE":       "ort-server",
+		"ANALYZER_SENDER_TRANSPORT_IMAGE_NAME":      "ort-server-analyzer-worker:1.0",
+		"ANALYZER_SENDER_TRANSPORT_SERVICE_ACCOUNT": "ort-server-worker",
+		"ANALYZER_SENDER_TRANSPORT_MEMORY_LIMIT":    "8Gi",
+		"ANALYZER_RECEIVER_TRANSPORT_TYPE":          TransportKubernetes,
+		"ANALYZER_JAVA_OPTS":                        "-Xmx6g",
+	}
+	for name, value := range expected {
+		v, ok := vars[name]
+		if !ok {
+			t.Fatalf("expected environment variable %s to be set", name)
+		}
+		if actual := v.(map[string]interface{})["value"]; actual != value {
+			t.Fatalf("expected environment variable %s to be %s, got %v", name, value, actual)
+		}
+	}
+
+	if _, ok := vars["JAVA_OPTS"]; ok {
+		t.Fatalf("expected the worker environment not to apply to the orchestrator")
+	}
+	if _, ok := orchestrator["envFrom"]; ok {
+		t.Fatalf("expected the orchestrator not to load worker ConfigMaps, got %v", orchestrator["envFrom"])
+	}
+}
+
+func TestRabbitMQWorker(t *testing.T) {
+	resources := run(t, testArgs())
+	deployment := lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-reporter-worker")
+
+	replicas := deployment["spec"].(map[string]interface{})["replicas"]
+	if replicas != 3.0 {
+		t.Fatalf("expected 3 replicas, got %v", replicas)
+	}
+
+	if podSpec(deployment)["serviceAccountName"] != "ort-server-worker" {
+		t.Fatalf("expected the worker to run as ort-server-worker")
+	}
+
+	vars := env(container(deployment))
+	queue := vars["REPORTER_RECEIVER_TRANSPORT_QUEUE_NAME"].(map[string]interface{})["value"]
+	if queue != "reporter_queue" {
+		t.Fatalf("expected the reporter to consume reporter_queue, got %v", queue)
+	}
+
+	orchestrator := env(container(lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-orchestrator")))
+	transport := orchestrator["REPORTER_SENDER_TRANSPORT_TYPE"].(map[string]interface{})["value"]
+	if transport != TransportRabbitMQ {
+		t.Fatalf("expected the orchestrator to send reporter messages via RabbitMQ, got %v", transport)
+	}
+}
+
+func TestVault(t *testing.T) {
+	args := testArgs()
+	args.Vault = &VaultArgs{
+		URI:          pulumi.String("https://vault.ort-server.svc:8200"),
+		Prefix:       pulumi.String("ort-server"),
+		SecretName:   pulumi.String("ort-server-vault"),
+		CASecretName: pulumi.String("tls-ca"),
+	}
+
+	resources := run(t, args)
+	deployment := lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-core")
+
+	if podSpec(deployment)["serviceAccountName"] != CoreServiceAccountName {
+		t.Fatalf("expected service account %s, got %v", CoreServiceAccountName, podSpec(deployment)["serviceAccountName"])
+	}
+
+	vars := env(container(deployment))
+	expected := map[string]string{
+		"SECRETS_PROVIDER_NAME": "vault",
+		"VAULT_URI":             "https://vault.ort-server.svc:8200",
+		"VAULT_PREFIX":          "ort-server",
+		"JAVA_TOOL_OPTIONS":     "-Djavax.net.ssl.trustStore=/truststore/cacerts",
+	}
+	for name, value := range expected {
+		v, ok := vars[name]
+		if !ok {
+			t.Fatalf("expected environment variable %s to be set", name)
+		}
+		if actual := v.(map[string]interface{})["value"]; actual != value {
+			t.Fatalf("expected environment variable %s to be %s, got %v", name, value, actual)
+		}
+	}
+
+	if _, ok := vars["VAULT_SECRET_ID"].(map[string]interface{})["valueFrom"]; !ok {
+		t.Fatalf("expected VAULT_SECRET_ID to be read from a secret")
+	}
+
+	initContainers, ok := podSpec(deployment)["initContainers"].([]interface{})
+	if !ok || len(initContainers) != 1 {
+		t.Fatalf("expected an init container creating the trust store, got %v", podSpec(deployment)["initContainers"])
+	}
+
+	orchestrator := env(container(lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-orchestrator")))
+	if _, ok := orchestrator["VAULT_ROLE_ID"]; !ok {
+		t.Fatalf("expected the orchestrator to use Vault")
+	}
+	// The Jobs do not run the init container creating the trust store, they mount the published one.
+	jobEnv := map[string]string{
+		"ANALYZER_JAVA_TOOL_OPTIONS":               "-Djavax.net.ssl.trustStore=/truststore/cacerts",
+		"ANALYZER_SENDER_TRANSPORT_SECRET_VOLUMES": "ort-server-truststore->/truststore",
+	}
+	for name, value := range jobEnv {
+		if v, ok := orchestrator[name]; !ok || v.(map[string]interface{})["value"] != value {
+			t.Fatalf("expected %s to be %s, got %v", name, value, v)
+		}
+	}
+
+	lookup(t, resources, "kubernetes:core/v1:Secret::ort-server-truststore")
+	job := lookup(t, resources, "kubernetes:batch/v1:Job::ort-server-truststore")
+	jobSpec := job["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	if len(jobSpec["initContainers"].([]interface{})) != 1 {
+		t.Fatalf("expected the trust store Job to build the trust store in an init container, got %v", jobSpec)
+	}
+
+	worker := lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-reporter-worker")
+	if _, ok := env(container(worker))["VAULT_ROLE_ID"]; !ok {
+		t.Fatalf("expected the RabbitMQ workers to use Vault")
+	}
+}
+
+func TestTrustStore(t *testing.T) {
+	args := testArgs()
+	args.Vault = &VaultArgs{
+		URI:          pulumi.String("https://vault.ort-server.svc:8200"),
+		Prefix:       pulumi.String("ort-server"),
+		SecretName:   pulumi.String("ort-server-vault"),
+		CASecretName: pulumi.String("vault-tls-ca"),
+	}
+	args.Keycloak.CASecretName = pulumi.String("keycloak-tls-ca")
+	args.RabbitMQ.CASecretName = pulumi.String("rabbitmq-tls-ca")
+
+	resources := run(t, args)
+	spec := podSpec(lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-core"))
+
+	secrets := map[string]interface{}{}
+	for _, volume := range spec["volumes"].([]interface{}) {
+		v := volume.(map[string]interface{})
+		if secret, ok := v["secret"].(map[string]interface{}); ok {
+			secrets[v["name"].(string)] = secret["secretName"]
+		}
+	}
+	expected := map[string]interface{}{
+		"vault-ca":    "vault-tls-ca",
+		"keycloak-ca": "keycloak-tls-ca",
+		"rabbitmq-ca": "rabbitmq-tls-ca",
+	}
+	for name, secretName := range expected {
+		if secrets[name] != secretName {
+			t.Fatalf("expected volume %s with secret %s, got %v", name, secretName, secrets)
+		}
+	}
+
+	initContainer := spec["initContainers"].([]interface{})[0].(map[string]interface{})
+	command := initContainer["command"].([]interface{})[2].(string)
+	for _, alias := range []string{"-alias vault-ca", "-alias keycloak-ca", "-alias rabbitmq-ca"} {
+		if !strings.Contains(command, alias) {
+			t.Fatalf("expected the init container to import %s, got %s", alias, command)
+		}
+	}
+}
+
+func TestDatabaseHost(t *testing.T) {
+	args := testArgs()
+	args.Database.Host = pulumi.String("postgresql-pooler-rw")
+
+	resources := run(t, args)
+	deployment := lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-core")
+
+	host := env(container(deployment))["DB_HOST"].(map[string]interface{})
+	if host["value"] != "postgresql-pooler-rw" {
+		t.Fatalf("expected DB_HOST to be postgresql-pooler-rw, got %v", host)
+	}
+
+	deployment = lookup(t, resources, "kubernetes:apps/v1:Deployment::ort-server-orchestrator")
+	if _, ok := env(container(deployment))["DB_HOST"].(map[string]interface{})["valueFrom"]; ok {
+		t.Fatalf("expected the orchestrator to use the host override, too")
+	}
+}
@@ -0,0 +1,249 @@
+package ortserver
+
+import (
+	"fmt"
+	pulumibatchv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/batch/v1"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	pulumirbacv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/rbac/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+)
+
+const (
+	trustStoreDir  = "/truststore"
+	trustStorePath = trustStoreDir + "/cacerts"
+	// trustStoreSecretName is the secret the trust store is published in for the worker Jobs, see
+	// createTrustStoreSecret.
+	trustStoreSecretName = "ort-server-truststore"
+)
+
+// trustedCA is a CA certificate of an internal service that is added to the trust store.
+type trustedCA struct {
+	// name is the alias of the certificate in the trust store and the name of the volume it is mounted from.
+	name string
+	// secretName is the name of a secret with the key ca.crt.
+	secretName pulumi.StringInput
+}
+
+// trustedCAs returns the CA certificates of the internal services whose certificates are signed by a private CA.
+func trustedCAs(args *Args) []trustedCA {
+	var cas []trustedCA
+	if args.Vault != nil && args.Vault.CASecretName != nil {
+		cas = append(cas, trustedCA{name: "vault-ca", secretName: args.Vault.CASecretName})
+	}
+	if args.Keycloak.CASecretName != nil {
+		cas = append(cas, trustedCA{name: "keycloak-ca", secretName: args.Keycloak.CASecretName})
+	}
+	if args.RabbitMQ.CASecretName != nil {
+		cas = append(cas, trustedCA{name: "rabbitmq-ca", secretName: args.RabbitMQ.CASecretName})
+	}
+	return cas
+}
+
+// usesTrustStore returns whether the containers get a trust store with the CA certificates of the internal services.
+func usesTrustStore(args *Args) bool {
+	return len(trustedCAs(args)) > 0
+}
+
+// trustStoreJavaOptions returns the JAVA_TOOL_OPTIONS making the JVM use the trust store.
+func trustStoreJavaOptions() string {
+	return "-Djavax.net.ssl.trustStore=" + trustStorePath
+}
+
+// addTrustStore adds the CA certificates to a copy of the JVM's default trust store and makes the container use it.
+func addTrustStore(spec *pulumiv1.PodSpecArgs, container *pulumiv1.ContainerArgs, cas []trustedCA) {
+	initContainer, volumes := trustStoreInitContainer(container.Image, cas)
+	spec.InitContainers = pulumiv1.ContainerArray{initContainer}
+	spec.Volumes = volumes
+
+	env, _ := container.Env.(pulumiv1.EnvVarArray)
+	container.Env = append(env, valueEnv("JAVA_TOOL_OPTIONS", trustStoreJavaOptions()))
+	container.VolumeMounts = pulumiv1.VolumeMountArray{
+		pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String("truststore"),
+			MountPath: pulumi.String(trustStoreDir),
+			ReadOnly:  pulumi.Bool(true),
+		},
+	}
+}
+
+// trustStoreInitContainer returns an init container creating the trust store in the volume "truststore", and the
+// volumes it mounts. It runs image, which should be the image of the JVM using the trust store, so that the copy of the
+// default trust store contains the same public CAs.
+func trustStoreInitContainer(
+	image pulumi.StringPtrInput,
+	cas []trustedCA,
+) (pulumiv1.ContainerArgs, pulumiv1.VolumeArray) {
+	commands := []string{"cp \"$JAVA_HOME/lib/security/cacerts\" " + trustStorePath}
+	mounts := pulumiv1.VolumeMountArray{
+		pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String("truststore"),
+			MountPath: pulumi.String(trustStoreDir),
+		},
+	}
+	volumes := pulumiv1.VolumeArray{
+		pulumiv1.VolumeArgs{
+			Name:     pulumi.String("truststore"),
+			EmptyDir: pulumiv1.EmptyDirVolumeSourceArgs{},
+		},
+	}
+
+	for _, ca := range cas {
+		commands = append(commands, fmt.Sprintf(
+			"keytool -importcert -noprompt -alias %s -file /%s/ca.crt -keystore %s -storepass changeit",
+			ca.name,
+			ca.name,
+			trustStorePath,
+		))
+		mounts = append(mounts, pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String(ca.name),
+			MountPath: pulumi.String("/" + ca.name),
+			ReadOnly:  pulumi.Bool(true),
+		})
+		volumes = append(volumes, pulumiv1.VolumeArgs{
+			Name: pulumi.String(ca.name),
+			Secret: pulumiv1.SecretVolumeSourceArgs{
+				SecretName: ca.secretName,
+			},
+		})
+	}
+
+	initContainer := pulumiv1.ContainerArgs{
+		Name:  pulumi.String("truststore"),
+		Image: image,
+		Command: pulumi.StringArray{
+			pulumi.String("/bin/sh"),
+			pulumi.String("-c"),
+			pulumi.String(strings.Join(commands, " && ")),
+		},
+		VolumeMounts: mounts,
+	}
+
+	return initContainer, volumes
+}
+
+// createTrustStoreSecret publishes the trust store in the secret ort-server-truststore, which the orchestrator mounts
+// into the worker Jobs, because the Kubernetes transport can't give them an init container. The secret is created
+// empty and filled by a Job, which builds the trust store with the orchestrator image and stores it with kubectl. The
+// Job is replaced and runs again when the CA secrets or the images change.
+func createTrustStoreSecret(ctx *pulumi.Context, component *ORTServer, args *Args) error {
+	var err error
+	component.trustStoreSecret, err = pulumiv1.NewSecret(
+		ctx,
+		trustStoreSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: metadata(args, trustStoreSecretName),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+		// The data is written by the Job.
+		pulumi.IgnoreChanges([]string{"data", "stringData"}),
+	)
+	if err != nil {
+		return err
+	}
+
+	serviceAccount, err := pulumiv1.NewServiceAccount(
+		ctx,
+		trustStoreSecretName,
+		&pulumiv1.ServiceAccountArgs{
+			Metadata: metadata(args, trustStoreSecretName),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	role, err := pulumirbacv1.NewRole(
+		ctx,
+		trustStoreSecretName,
+		&pulumirbacv1.RoleArgs{
+			Metadata: metadata(args, trustStoreSecretName),
+			Rules: pulumirbacv1.PolicyRuleArray{
+				pulumirbacv1.PolicyRuleArgs{
+					ApiGroups:     pulumi.ToStringArray([]string{""}),
+					Resources:     pulumi.ToStringArray([]string{"secrets"}),
+					ResourceNames: pulumi.ToStringArray([]string{trustStoreSecretName}),
+					Verbs:         pulumi.ToStringArray([]string{"get", "patch"}),
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	roleBinding, err := pulumirbacv1.NewRoleBinding(
+		ctx,
+		trustStoreSecretName,
+		&pulumirbacv1.RoleBindingArgs{
+			Metadata: metadata(args, trustStoreSecretName),
+			Subjects: pulumirbacv1.SubjectArray{
+				pulumirbacv1.SubjectArgs{
+					Kind:      pulumi.String("ServiceAccount"),
+					Name:      serviceAccount.Metadata.Name().Elem(),
+					Namespace: args.Namespace.Metadata.Name(),
+				},
+			},
+			RoleRef: pulumirbacv1.RoleRefArgs{
+				Kind:     pulumi.String("Role"),
+				Name:     role.Metadata.Name().Elem(),
+				ApiGroup: pulumi.String("rbac.authorization.k8s.io"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	initContainer, volumes := trustStoreInitContainer(pulumi.String(args.Orchestrator.Image), trustedCAs(args))
+	publish := fmt.Sprintf(
+		"manifest=$(kubectl create secret generic %s --from-file=cacerts=%s --dry-run=client -o yaml) && "+
+			"echo \"$manifest\" | kubectl apply -f -",
+		trustStoreSecretName,
+		trustStorePath,
+	)
+
+	// The Job is named by Pulumi, so that a replacement can be created before the previous Job is deleted.
+	component.trustStoreJob, err = pulumibatchv1.NewJob(
+		ctx,
+		trustStoreSecretName,
+		&pulumibatchv1.JobArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Namespace: args.Namespace.Metadata.Name(),
+				Labels:    selector(trustStoreSecretName),
+			},
+			Spec: pulumibatchv1.JobSpecArgs{
+				BackoffLimit: pulumi.Int(3),
+				Template: pulumiv1.PodTemplateSpecArgs{
+					Spec: pulumiv1.PodSpecArgs{
+						ServiceAccountName: serviceAccount.Metadata.Name(),
+						RestartPolicy:      pulumi.String("OnFailure"),
+						InitContainers:     pulumiv1.ContainerArray{initContainer},
+						Containers: pulumiv1.ContainerArray{
+							pulumiv1.ContainerArgs{
+								Name:    pulumi.String("publish"),
+								Image:   pulumi.String(args.KubectlImage),
+								Command: pulumi.ToStringArray([]string{"/bin/sh", "-c", publish}),
+								VolumeMounts: pulumiv1.VolumeMountArray{
+									pulumiv1.VolumeMountArgs{
+										Name:      pulumi.String("truststore"),
+										MountPath: pulumi.String(trustStoreDir),
+										ReadOnly:  pulumi.Bool(true),
+									},
+								},
+							},
+						},
+						Volumes: volumes,
+					},
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+		pulumi.DependsOn([]pulumi.Resource{component.trustStoreSecret, roleBinding}),
+	)
+	return err
+}
@@ -0,0 +1,211 @@
+package ortserver
+
+import (
+	"fmt"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"sort"
+	"strings"
+)
+
+const (
+	// TransportKubernetes makes the orchestrator start a Kubernetes Job for every worker invocation.
+	TransportKubernetes = "kubernetes"
+	// TransportRabbitMQ runs the worker as a Deployment that consumes its queue.
+	TransportRabbitMQ = "rabbitMQ"
+)
+
+// workerNames lists the ORT Server workers in the order in which they take part in an ORT run.
+var workerNames = []string{"config", "analyzer", "advisor", "scanner", "evaluator", "reporter", "notifier"}
+
+// WorkerArgs describes one of the ORT Server workers.
+type WorkerArgs struct {
+	Name  string `json:"-"`
+	Image string `json:"image"`
+	// Transport is either TransportKubernetes or TransportRabbitMQ.
+	Transport string `json:"transport"`
+	// QueueName is the RabbitMQ queue the worker consumes if Transport is TransportRabbitMQ.
+	QueueName string `json:"queueName"`
+	// Replicas is the number of worker pods if Transport is TransportRabbitMQ.
+	Replicas  int       `json:"replicas"`
+	Resources Resources `json:"resources"`
+	// Env contains environment variables for this worker only.
+	Env map[string]string `json:"env"`
+}
+
+// envPrefix returns the prefix of the worker's configuration variables, e.g. "ANALYZER".
+func (w WorkerArgs) envPrefix() string {
+	return strings.ToUpper(w.Name)
+}
+
+func (w WorkerArgs) resourceName() string {
+	return fmt.Sprintf("ort-server-%s-worker", w.Name)
+}
+
+// createWorkers creates the service account the worker pods run as, and a ConfigMap with the environment and a
+// Deployment for every worker using TransportRabbitMQ. The other workers are started by the orchestrator, see
+// workerSenderEnv.
+func createWorkers(ctx *pulumi.Context, component *ORTServer, args *Args) error {
+	var err error
+	component.workerServiceAccount, err = pulumiv1.NewServiceAccount(
+		ctx,
+		"ort-server-worker",
+		&pulumiv1.ServiceAccountArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String("ort-server-worker"),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, worker := range args.Workers {
+		if worker.Transport != TransportRabbitMQ {
+			continue
+		}
+
+		configMap, err := pulumiv1.NewConfigMap(
+			ctx,
+			worker.resourceName(),
+			&pulumiv1.ConfigMapArgs{
+				Metadata: metadata(args, worker.resourceName()),
+				Data:     workerConfig(worker),
+			},
+			pulumi.ResourceOption(pulumi.Parent(component)),
+		)
+		if err != nil {
+			return err
+		}
+		component.workerConfigMaps = append(component.workerConfigMaps, configMap)
+
+		env := databaseEnv(args)
+		env = append(env, rabbitMQEnv(args, "ORCHESTRATOR_SENDER", "orchestrator_queue")...)
+		env = append(env, rabbitMQEnv(args, worker.envPrefix()+"_RECEIVER", worker.QueueName)...)
+		env = append(env, vaultEnv(args)...)
+
+		container := pulumiv1.ContainerArgs{
+			Name:      pulumi.String(worker.Name),
+			Image:     pulumi.String(worker.Image),
+			Env:       mergeEnv(env, args.Env),
+			EnvFrom:   configMapEnvFrom(configMap),
+			Resources: worker.Resources.toResourceRequirements(),
+		}
+
+		deployment, err := newDeployment(
+			ctx,
+			component,
+			args,
+			worker.resourceName(),
+			worker.Replicas,
+			container,
+			component.workerServiceAccount.Metadata.Name(),
+		)
+		if err != nil {
+			return err
+		}
+		component.workerDeployments = append(component.workerDeployments, deployment)
+	}
+
+	return nil
+}
+
+func workerConfig(worker WorkerArgs) pulumi.StringMap {
+	config := pulumi.StringMap{
+		worker.envPrefix() + "_RECEIVER_TRANSPORT_TYPE": pulumi.String(worker.Transport),
+	}
+
+	for name, value := range worker.Env {
+		config[name] = pulumi.String(value)
+	}
+
+	return config
+}
+
+// workerSenderEnv returns the variables the orchestrator needs to dispatch messages to the workers.
+func workerSenderEnv(args *Args) []pulumiv1.EnvVarArgs {
+	var env []pulumiv1.EnvVarArgs
+
+	for _, worker := range args.Workers {
+		prefix := worker.envPrefix() + "_SENDER"
+
+		if worker.Transport == TransportRabbitMQ {
+			env = append(env, rabbitMQEnv(args, prefix, worker.QueueName)...)
+			continue
+		}
+
+		env = append(env,
+			valueEnv(worker.envPrefix()+"_RECEIVER_TRANSPORT_TYPE", TransportKubernetes),
+			valueEnv(prefix+"_TRANSPORT_TYPE", TransportKubernetes),
+			inputEnv(prefix+"_TRANSPORT_NAMESPACE", args.Namespace.Metadata.Name().Elem()),
+			valueEnv(prefix+"_TRANSPORT_IMAGE_NAME", worker.Image),
+			valueEnv(prefix+"_TRANSPORT_SERVICE_ACCOUNT", "ort-server-worker"),
+			valueEnv(prefix+"_TRANSPORT_RESTART_POLICY", "OnFailure"),
+			valueEnv(prefix+"_TRANSPORT_BACKOFF_LIMIT", "2"),
+		)
+
+		if usesTrustStore(args) {
+			env = append(env, valueEnv(prefix+"_TRANSPORT_SECRET_VOLUMES", trustStoreSecretName+"->"+trustStoreDir))
+		}
+
+		resources := map[string]string{
+			"CPU_REQUEST":    worker.Resources.CPURequest,
+			"CPU_LIMIT":      worker.Resources.CPULimit,
+			"MEMORY_REQUEST": worker.Resources.MemoryRequest,
+			"MEMORY_LIMIT":   worker.Resources.MemoryLimit,
+		}
+		for _, key := range []string{"CPU_REQUEST", "CPU_LIMIT", "MEMORY_REQUEST", "MEMORY_LIMIT"} {
+			if resources[key] != "" {
+				env = append(env, valueEnv(prefix+"_TRANSPORT_"+key, resources[key]))
+			}
+		}
+
+		env = append(env, jobWorkerEnv(args, worker)...)
+	}
+
+	return env
+}
+
+// jobWorkerEnv returns the environment of a worker started as Kubernetes Job, with the names prefixed by the worker's
+// prefix, e.g. "ANALYZER_JAVA_OPTS". The Kubernetes transport passes the orchestrator's environment on to the Jobs it
+// creates, and sets the variables with the prefix of the Job's worker without the prefix. This keeps them out of the
+// orchestrator and the Jobs of the other workers.
+func jobWorkerEnv(args *Args, worker WorkerArgs) []pulumiv1.EnvVarArgs {
+	workerEnv := make(map[string]string, len(worker.Env)+1)
+	for name, value := range worker.Env {
+		workerEnv[name] = value
+	}
+	// The Jobs can't run the init container creating the trust store, so they mount the one published by the
+	// trust store Job instead.
+	if _, ok := workerEnv["JAVA_TOOL_OPTIONS"]; !ok && usesTrustStore(args) {
+		workerEnv["JAVA_TOOL_OPTIONS"] = trustStoreJavaOptions()
+	}
+
+	names := make([]string, 0, len(workerEnv))
+	for name := range workerEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]pulumiv1.EnvVarArgs, 0, len(names))
+	for _, name := range names {
+		env = append(env, valueEnv(worker.envPrefix()+"_"+name, workerEnv[name]))
+	}
+
+	return env
+}
+
+func configMapEnvFrom(configMaps ...*pulumiv1.ConfigMap) pulumiv1.EnvFromSourceArray {
+	var envFrom pulumiv1.EnvFromSourceArray
+	for _, configMap := range configMaps {
+		envFrom = append(envFrom, pulumiv1.EnvFromSourceArgs{
+			ConfigMapRef: pulumiv1.ConfigMapEnvSourceArgs{
+				Name: configMap.Metadata.Name(),
+			},
+		})
+	}
+	return envFrom
+}
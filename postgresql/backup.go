@@ -0,0 +1,154 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const backupSecretName = "postgresql-backup-s3"
+
+// BackupArgs configures continuous backups with barman to an S3 compatible object store: the WAL is archived
+// continuously and base backups are taken on a schedule. For local testing with MinIO, set Endpoint to the MinIO
+// service, e.g. "http://minio.minio.svc:9000", and DestinationPath to a bucket created in MinIO.
+type BackupArgs struct {
+	// Endpoint is the URL of the S3 API. It can be empty for AWS S3.
+	Endpoint string `json:"endpoint"`
+	// DestinationPath is the URL of the bucket and path the backups are stored below, e.g. "s3://backups/postgresql".
+	DestinationPath string `json:"destinationPath"`
+	// ServerName is the directory below DestinationPath the backups of this cluster are stored in. Defaults to the name
+	// of the cluster. A cluster restored from a backup has to use a different one than the cluster the backup is from.
+	ServerName string `json:"serverName"`
+	// Schedule is the cron expression for base backups. It has six fields, the first one being seconds.
+	Schedule string `json:"schedule"`
+	// RetentionPolicy is the age after which backups and archived WAL files are deleted, e.g. "30d".
+	RetentionPolicy string             `json:"retentionPolicy"`
+	AccessKey       pulumi.StringInput `json:"-"`
+	SecretKey       pulumi.StringInput `json:"-"`
+}
+
+// RecoveryArgs bootstraps the cluster from a backup in the object store configured by BackupArgs instead of creating
+// an empty one. This only has an effect when the cluster is created, so restoring an existing cluster requires deleting
+// it first.
+type RecoveryArgs struct {
+	// SourceServerName is the ServerName of the cluster the backup is from.
+	SourceServerName string `json:"sourceServerName"`
+	// TargetTime is the point in time to recover to in RFC 3339 format. If empty, all archived WAL is replayed.
+	TargetTime string `json:"targetTime"`
+}
+
+// recoverySourceName is the name of the external cluster that refers to the backup to recover from.
+const recoverySourceName = "recovery-source"
+
+func createBackupSecret(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) (*pulumiv1.Secret, error) {
+	return pulumiv1.NewSecret(
+		ctx,
+		backupSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(backupSecretName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			StringData: pulumi.StringMap{
+				"ACCESS_KEY_ID":     args.Backup.AccessKey,
+				"ACCESS_SECRET_KEY": args.Backup.SecretKey,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
+
+// barmanObjectStore returns the object store configuration of the cluster spec for the given server name.
+func barmanObjectStore(backup *BackupArgs, serverName string) pulumi.Map {
+	store := pulumi.Map{
+		"destinationPath": pulumi.String(backup.DestinationPath),
+		"serverName":      pulumi.String(serverName),
+		"s3Credentials": pulumi.Map{
+			"accessKeyId": pulumi.Map{
+				"name": pulumi.String(backupSecretName),
+				"key":  pulumi.String("ACCESS_KEY_ID"),
+			},
+			"secretAccessKey": pulumi.Map{
+				"name": pulumi.String(backupSecretName),
+				"key":  pulumi.String("ACCESS_SECRET_KEY"),
+			},
+		},
+		"wal": pulumi.Map{
+			"compression": pulumi.String("gzip"),
+		},
+		"data": pulumi.Map{
+			"compression": pulumi.String("gzip"),
+		},
+	}
+
+	if backup.Endpoint != "" {
+		store["endpointURL"] = pulumi.String(backup.Endpoint)
+	}
+
+	return store
+}
+
+// backupSpec returns the fields of the cluster spec for backups to serverName and recovery. It requires args.Backup.
+func backupSpec(args *ClusterArgs, serverName string) pulumi.Map {
+	spec := pulumi.Map{}
+	spec["backup"] = pulumi.Map{
+		"barmanObjectStore": barmanObjectStore(args.Backup, serverName),
+		"retentionPolicy":   pulumi.String(args.Backup.RetentionPolicy),
+	}
+
+	if args.Recovery == nil {
+		return spec
+	}
+
+	recovery := pulumi.Map{
+		"source": pulumi.String(recoverySourceName),
+	}
+	if args.Recovery.TargetTime != "" {
+		recovery["recoveryTarget"] = pulumi.Map{
+			"targetTime": pulumi.String(args.Recovery.TargetTime),
+		}
+	}
+
+	spec["bootstrap"] = pulumi.Map{
+		"recovery": recovery,
+	}
+	spec["externalClusters"] = pulumi.MapArray{
+		pulumi.Map{
+			"name":              pulumi.String(recoverySourceName),
+			"barmanObjectStore": barmanObjectStore(args.Backup, args.Recovery.SourceServerName),
+		},
+	}
+
+	return spec
+}
+
+// createScheduledBackup creates the ScheduledBackup taking base backups of the cluster. The first one is taken
+// immediately, because the WAL archive is useless for recovery without a base backup.
+func createScheduledBackup(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) error {
+	_, err := apiextensions.NewCustomResource(ctx, "postgresql-scheduled-backup",
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("postgresql.cnpg.io/v1"),
+			Kind:       pulumi.String("ScheduledBackup"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String("postgresql"),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": pulumi.Map{
+					"schedule":             pulumi.String(args.Backup.Schedule),
+					"immediate":            pulumi.Bool(true),
+					"backupOwnerReference": pulumi.String("self"),
+					"method":               pulumi.String("barmanObjectStore"),
+					"cluster": pulumi.Map{
+						"name": component.cluster.Metadata.Name().Elem(),
+					},
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+
+	return err
+}
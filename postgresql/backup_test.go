@@ -0,0 +1,69 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"testing"
+)
+
+func TestBackupSpec(t *testing.T) {
+	args := &ClusterArgs{
+		Backup: &BackupArgs{
+			Endpoint:        "http://minio.minio.svc:9000",
+			DestinationPath: "s3://backups/postgresql",
+			ServerName:      "postgresql",
+			RetentionPolicy: "30d",
+		},
+	}
+
+	spec := backupSpec(args, "postgresql")
+	if _, ok := spec["bootstrap"]; ok {
+		t.Error("expected no bootstrap configuration without recovery args")
+	}
+
+	store := spec["backup"].(pulumi.Map)["barmanObjectStore"].(pulumi.Map)
+	if store["endpointURL"] != pulumi.String("http://minio.minio.svc:9000") {
+		t.Errorf("unexpected endpoint: %v", store["endpointURL"])
+	}
+	if store["serverName"] != pulumi.String("postgresql") {
+		t.Errorf("unexpected server name: %v", store["serverName"])
+	}
+}
+
+func TestBackupSpecRecovery(t *testing.T) {
+	args := &ClusterArgs{
+		Backup: &BackupArgs{
+			DestinationPath: "s3://backups/postgresql",
+			ServerName:      "postgresql-restored",
+			RetentionPolicy: "30d",
+		},
+		Recovery: &RecoveryArgs{
+			SourceServerName: "postgresql",
+			TargetTime:       "2024-05-01T12:00:00Z",
+		},
+	}
+
+	spec := backupSpec(args, "postgresql-restored")
+
+	recovery := spec["bootstrap"].(pulumi.Map)["recovery"].(pulumi.Map)
+	if recovery["source"] != pulumi.String(recoverySourceName) {
+		t.Errorf("unexpected recovery source: %v", recovery["source"])
+	}
+	target := recovery["recoveryTarget"].(pulumi.Map)
+	if target["targetTime"] != pulumi.String("2024-05-01T12:00:00Z") {
+		t.Errorf("unexpected target time: %v", target["targetTime"])
+	}
+
+	source := spec["externalClusters"].(pulumi.MapArray)[0].(pulumi.Map)
+	store := source["barmanObjectStore"].(pulumi.Map)
+	if store["serverName"] != pulumi.String("postgresql") {
+		t.Errorf("expected to recover from server postgresql, got %v", store["serverName"])
+	}
+	if _, ok := store["endpointURL"]; ok {
+		t.Error("expected no endpoint URL for AWS S3")
+	}
+
+	backupStore := spec["backup"].(pulumi.Map)["barmanObjectStore"].(pulumi.Map)
+	if backupStore["serverName"] != pulumi.String("postgresql-restored") {
+		t.Errorf("expected to archive to server postgresql-restored, got %v", backupStore["serverName"])
+	}
+}
@@ -0,0 +1,237 @@
+package postgresql
+
+import (
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// retentionPolicyPattern matches the retention policies supported by CloudNativePG.
+var retentionPolicyPattern = regexp.MustCompile(`^[1-9][0-9]*[dwm]$`)
+
+// identifierPattern matches the PostgreSQL identifiers that can be used without quoting.
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// LoadClusterArgs reads the "postgresql:*" keys from the stack configuration.
+func LoadClusterArgs(ctx *pulumi.Context, namespace *pulumiv1.Namespace) (*ClusterArgs, error) {
+	cfg := common.NewConfig(ctx, "postgresql")
+
+	// Without a size, only the storage size has a default, and the defaults of CloudNativePG apply to the rest.
+	size := cfg.String("size", "")
+	preset := sizePreset{storageSize: "1Gi"}
+	if size != "" {
+		cfg.OneOf("size", size, "small", "medium", "large")
+		if p, ok := sizePresets[size]; ok {
+			preset = p
+		}
+	}
+
+	args := &ClusterArgs{
+		Namespace:      namespace,
+		MajorVersion:   cfg.Int("majorVersion", defaultMajorVersion),
+		Upgrade:        cfg.Bool("upgrade", false),
+		Instances:      cfg.Int("instances", 3),
+		StorageSize:    cfg.String("storageSize", preset.storageSize),
+		StorageClass:   cfg.String("storageClass", ""),
+		WALStorageSize: cfg.String("walStorageSize", preset.walStorageSize),
+		Resources:      preset.resources,
+	}
+
+	args.ImageName = cfg.String("imageName", defaultImages[args.MajorVersion])
+	if args.ImageName == "" {
+		cfg.Errorf("imageName", "has no default for PostgreSQL %d and must be set", args.MajorVersion)
+	} else if major, err := imageMajorVersion(args.ImageName); err != nil {
+		cfg.Errorf("imageName", "%s", err)
+	} else if major != args.MajorVersion {
+		cfg.Errorf("imageName", "%q does not match postgresql:majorVersion %d", args.ImageName, args.MajorVersion)
+	}
+
+	cfg.Positive("instances", args.Instances)
+	cfg.Quantity("storageSize", args.StorageSize)
+	if args.WALStorageSize != "" {
+		cfg.Quantity("walStorageSize", args.WALStorageSize)
+	}
+
+	// Only the configured fields replace the ones of the preset.
+	cfg.Object("resources", &args.Resources)
+	for _, q := range []string{
+		args.Resources.CPURequest,
+		args.Resources.CPULimit,
+		args.Resources.MemoryRequest,
+		args.Resources.MemoryLimit,
+	} {
+		if q != "" {
+			cfg.Quantity("resources", q)
+		}
+	}
+
+	var parameters map[string]string
+	cfg.Object("parameters", &parameters)
+	args.Parameters = mergeParameters(preset.parameters, parameters)
+	for name := range parameters {
+		if slices.Contains(fixedParameters, name) {
+			cfg.Errorf("parameters", "%s is managed by CloudNativePG and cannot be set", name)
+		}
+	}
+
+	cfg.Object("databases", &args.Databases)
+	validateDatabases(cfg, args.Databases)
+
+	cfg.Object("backup", &args.Backup)
+	if backup := args.Backup; backup != nil {
+		if backup.ServerName == "" {
+			backup.ServerName = "postgresql"
+		}
+		if backup.Schedule == "" {
+			backup.Schedule = "0 0 2 * * *"
+		}
+		if backup.RetentionPolicy == "" {
+			backup.RetentionPolicy = "30d"
+		}
+
+		cfg.NotEmpty("backup.destinationPath", backup.DestinationPath)
+		if !retentionPolicyPattern.MatchString(backup.RetentionPolicy) {
+			cfg.Errorf("backup.retentionPolicy", "must be a number followed by d, w or m, got %q", backup.RetentionPolicy)
+		}
+		if len(strings.Fields(backup.Schedule)) != 6 {
+			cfg.Errorf("backup.schedule", "must be a cron expression with six fields, got %q", backup.Schedule)
+		}
+
+		backup.AccessKey = cfg.Secret("backupAccessKey")
+		backup.SecretKey = cfg.Secret("backupSecretKey")
+		if backup.AccessKey == nil || backup.SecretKey == nil {
+			cfg.Errorf("backup", "requires the secrets postgresql:backupAccessKey and postgresql:backupSecretKey")
+		}
+	}
+
+	cfg.Object("pooler", &args.Pooler)
+	if pooler := args.Pooler; pooler != nil {
+		if pooler.Instances == 0 {
+			pooler.Instances = 2
+		}
+		if pooler.PoolMode == "" {
+			pooler.PoolMode = "session"
+		}
+		if pooler.DefaultPoolSize == 0 {
+			pooler.DefaultPoolSize = 20
+		}
+		if pooler.MaxClientConnections == 0 {
+			pooler.MaxClientConnections = 1000
+		}
+
+		cfg.Positive("pooler.instances", pooler.Instances)
+		cfg.OneOf("pooler.poolMode", pooler.PoolMode, "session", "transaction")
+		cfg.Positive("pooler.defaultPoolSize", pooler.DefaultPoolSize)
+		cfg.Positive("pooler.maxClientConnections", pooler.MaxClientConnections)
+	}
+
+	cfg.Object("monitoring", &args.Monitoring)
+
+	cfg.Object("recovery", &args.Recovery)
+	if recovery := args.Recovery; recovery != nil {
+		cfg.NotEmpty("recovery.sourceServerName", recovery.SourceServerName)
+		if args.Backup == nil {
+			cfg.Errorf("recovery", "requires postgresql:backup for the object store to recover from")
+		} else if recovery.SourceServerName == args.Backup.ServerName {
+			cfg.Errorf(
+				"recovery.sourceServerName",
+				"must differ from backup.serverName, otherwise the restored cluster would archive into the backup",
+			)
+		}
+		if recovery.TargetTime != "" {
+			if _, err := time.Parse(time.RFC3339, recovery.TargetTime); err != nil {
+				cfg.Errorf("recovery.targetTime", "must be in RFC 3339 format, got %q", recovery.TargetTime)
+			}
+		}
+	}
+
+	cfg.Object("import", &args.Import)
+	if imp := args.Import; imp != nil {
+		if imp.Type == "" {
+			imp.Type = "microservice"
+		}
+		if imp.Port == 0 {
+			imp.Port = 5432
+		}
+		if imp.User == "" {
+			imp.User = "postgres"
+		}
+		if imp.SSLMode == "" {
+			imp.SSLMode = "prefer"
+		}
+
+		cfg.OneOf("import.type", imp.Type, "microservice", "monolith")
+		cfg.NotEmpty("import.host", imp.Host)
+		cfg.Positive("import.port", imp.Port)
+		cfg.OneOf("import.sslMode", imp.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+
+		if imp.Type == "microservice" && (len(imp.Databases) != 1 || imp.Databases[0] == "*") {
+			cfg.Errorf("import.databases", "must contain exactly one database name for the microservice type")
+		}
+		if imp.Type == "monolith" && len(imp.Databases) == 0 {
+			cfg.Errorf("import.databases", "must not be empty")
+		}
+		if imp.Type == "microservice" && len(imp.Roles) > 0 {
+			cfg.Errorf("import.roles", "can only be used with the monolith type")
+		}
+
+		imp.Password = cfg.Secret("importPassword")
+		if imp.Password == nil {
+			cfg.Errorf("import", "requires the secret postgresql:importPassword")
+		}
+		if args.Recovery != nil {
+			cfg.Errorf("import", "cannot be combined with postgresql:recovery")
+		}
+	}
+
+	// Recovery and import only bootstrap a new cluster, which an upgrade bootstraps by importing from the old one.
+	if args.Upgrade && (args.Recovery != nil || args.Import != nil) {
+		cfg.Errorf("upgrade", "cannot be combined with postgresql:recovery or postgresql:import")
+	}
+
+	return args, cfg.Err()
+}
+
+// validateDatabases checks the databases and sets the default owner.
+func validateDatabases(cfg *common.Config, databases []DatabaseArgs) {
+	var names, owners []string
+	reserved := []string{"app", "postgres", "template0", "template1", "streaming_replica"}
+
+	for i := range databases {
+		db := &databases[i]
+		if db.Owner == "" {
+			db.Owner = db.Name
+		}
+
+		if !identifierPattern.MatchString(db.Name) {
+			cfg.Errorf("databases", "name %q is not a lowercase PostgreSQL identifier", db.Name)
+		}
+		if !identifierPattern.MatchString(db.Owner) {
+			cfg.Errorf("databases", "owner %q of database %q is not a lowercase PostgreSQL identifier", db.Owner, db.Name)
+		}
+		if slices.Contains(reserved, db.Name) || slices.Contains(reserved, db.Owner) {
+			cfg.Errorf("databases", "database %q must not use any of the reserved names %q", db.Name, reserved)
+		}
+		if slices.Contains(names, db.Name) {
+			cfg.Errorf("databases", "database %q is configured more than once", db.Name)
+		}
+		if slices.Contains(owners, db.Owner) {
+			cfg.Errorf("databases", "role %q owns more than one database", db.Owner)
+		}
+		if db.ConnectionLimit < 0 {
+			cfg.Errorf("databases", "connectionLimit of database %q must not be negative", db.Name)
+		}
+		for _, extension := range db.Extensions {
+			if !identifierPattern.MatchString(extension) {
+				cfg.Errorf("databases", "extension %q of database %q is not a valid extension name", extension, db.Name)
+			}
+		}
+
+		names = append(names, db.Name)
+		owners = append(owners, db.Owner)
+	}
+}
@@ -0,0 +1,193 @@
+package postgresql
+
+import (
+	"fmt"
+	pulumibatchv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/batch/v1"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+)
+
+// DatabaseArgs describes an application database and the role owning it.
+type DatabaseArgs struct {
+	Name string `json:"name"`
+	// Owner is the name of the role owning the database. Defaults to Name.
+	Owner string `json:"owner"`
+	// Extensions are created in the database by the owner, so only trusted extensions like pgcrypto are possible.
+	Extensions []string `json:"extensions"`
+	// ConnectionLimit is the maximum number of concurrent connections to the database. Zero means no limit.
+	ConnectionLimit int `json:"connectionLimit"`
+}
+
+// Database holds the outputs for one of ClusterArgs.Databases.
+type Database struct {
+	// Name is the name of the database. It only resolves once the database has been created.
+	Name pulumi.StringOutput
+	// SecretName is the name of the secret holding the credentials of the owner. It contains the keys username and
+	// password.
+	SecretName pulumi.StringOutput
+}
+
+// database holds the resources created for one of ClusterArgs.Databases.
+type database struct {
+	args     DatabaseArgs
+	password *random.RandomPassword
+	secret   *pulumiv1.Secret
+	job      *pulumibatchv1.Job
+}
+
+// kubernetesName turns a PostgreSQL identifier into a valid name for Kubernetes resources.
+func kubernetesName(identifier string) string {
+	return strings.ReplaceAll(identifier, "_", "-")
+}
+
+func createRoleSecret(ctx *pulumi.Context, component *Cluster, db *database) error {
+	var err error
+	name := kubernetesName(db.args.Owner)
+
+	db.password, err = random.NewRandomPassword(
+		ctx,
+		fmt.Sprintf("%s-postgresql-password", name),
+		&random.RandomPasswordArgs{
+			Length: pulumi.Int(16),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	resourceName := "postgresql-" + name
+	opts := []pulumi.ResourceOption{pulumi.Parent(component)}
+	if name == "keycloak" {
+		// This secret was created with a copy-pasted resource name before databases became configurable.
+		opts = append(opts, pulumi.Aliases([]pulumi.Alias{{Name: pulumi.String("keycloak-tls")}}))
+	}
+
+	db.secret, err = pulumiv1.NewSecret(
+		ctx,
+		resourceName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(resourceName),
+				Namespace: pulumi.String("ort-server"),
+				Labels: pulumi.StringMap{
+					"cnpg.io/reload": pulumi.String("true"),
+				},
+			},
+			Type: pulumi.String("kubernetes.io/basic-auth"),
+			StringData: pulumi.StringMap{
+				"username": pulumi.String(db.args.Owner),
+				"password": db.password.Result,
+			},
+		},
+		opts...,
+	)
+
+	return err
+}
+
+// managedRole returns the entry for the owner of the database in the managed roles of the CloudNativePG cluster.
+func managedRole(db *database) pulumi.Map {
+	return pulumi.Map{
+		"name":      pulumi.String(db.args.Owner),
+		"ensure":    pulumi.String("present"),
+		"login":     pulumi.Bool(true),
+		"superuser": pulumi.Bool(false),
+		// The role creates its own database, see newDatabaseJob.
+		"createdb": pulumi.Bool(true),
+		"passwordSecret": pulumi.Map{
+			"name": db.secret.Metadata.Name(),
+		},
+	}
+}
+
+// newDatabaseJob creates a job that creates the database as its owner and applies the remaining settings.
+// CloudNativePG 1.23 only manages roles, not databases. The job is idempotent and it is retried until the operator
+// has created the role. Changing the settings replaces the job, so that it runs again.
+func newDatabaseJob(
+	ctx *pulumi.Context,
+	component *Cluster,
+	db *database,
+	host pulumi.StringInput,
+	imageName string,
+	namespace *pulumiv1.Namespace,
+) (*pulumibatchv1.Job, error) {
+	secretEnv := func(name, key string) pulumiv1.EnvVarInput {
+		return pulumiv1.EnvVarArgs{
+			Name: pulumi.String(name),
+			ValueFrom: pulumiv1.EnvVarSourceArgs{
+				SecretKeyRef: pulumiv1.SecretKeySelectorArgs{
+					Name: db.secret.Metadata.Name().Elem(),
+					Key:  pulumi.String(key),
+				},
+			},
+		}
+	}
+
+	name := fmt.Sprintf("postgresql-create-%s-database", kubernetesName(db.args.Name))
+	return pulumibatchv1.NewJob(
+		ctx,
+		name,
+		&pulumibatchv1.JobArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(name),
+				Namespace: namespace.Metadata.Name(),
+			},
+			Spec: pulumibatchv1.JobSpecArgs{
+				BackoffLimit: pulumi.Int(10),
+				Template: pulumiv1.PodTemplateSpecArgs{
+					Spec: pulumiv1.PodSpecArgs{
+						RestartPolicy: pulumi.String("OnFailure"),
+						Containers: pulumiv1.ContainerArray{
+							pulumiv1.ContainerArgs{
+								Name:    pulumi.String("psql"),
+								Image:   pulumi.String(imageName),
+								Command: pulumi.StringArray{pulumi.String("/bin/sh"), pulumi.String("-c")},
+								Args:    pulumi.StringArray{pulumi.String(databaseScript(db.args))},
+								Env: pulumiv1.EnvVarArray{
+									pulumiv1.EnvVarArgs{Name: pulumi.String("PGHOST"), Value: host},
+									pulumiv1.EnvVarArgs{Name: pulumi.String("PGDATABASE"), Value: pulumi.String("postgres")},
+									secretEnv("PGUSER", "username"),
+									secretEnv("PGPASSWORD", "password"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		pulumi.DependsOn([]pulumi.Resource{component.cluster}),
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
+
+// databaseScript returns the shell script run by the job of newDatabaseJob.
+func databaseScript(db DatabaseArgs) string {
+	connectionLimit := db.ConnectionLimit
+	if connectionLimit == 0 {
+		connectionLimit = -1
+	}
+
+	lines := []string{
+		"set -e",
+		fmt.Sprintf(
+			`echo "SELECT 'CREATE DATABASE %[1]s' WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = '%[1]s')\gexec"`+
+				" | psql -v ON_ERROR_STOP=1",
+			db.Name,
+		),
+		fmt.Sprintf(`psql -v ON_ERROR_STOP=1 -c "ALTER DATABASE %s CONNECTION LIMIT %d"`, db.Name, connectionLimit),
+	}
+
+	for _, extension := range db.Extensions {
+		lines = append(lines, fmt.Sprintf(
+			`psql -v ON_ERROR_STOP=1 -d %s -c 'CREATE EXTENSION IF NOT EXISTS "%s"'`,
+			db.Name,
+			extension,
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,49 @@
+package postgresql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDatabaseScript(t *testing.T) {
+	script := databaseScript(DatabaseArgs{
+		Name:            "dependency_track",
+		Owner:           "dtrack",
+		Extensions:      []string{"pgcrypto"},
+		ConnectionLimit: 20,
+	})
+
+	expected := []string{
+		`echo "SELECT 'CREATE DATABASE dependency_track' WHERE NOT EXISTS ` +
+			`(SELECT FROM pg_database WHERE datname = 'dependency_track')\gexec" | psql -v ON_ERROR_STOP=1`,
+		`psql -v ON_ERROR_STOP=1 -c "ALTER DATABASE dependency_track CONNECTION LIMIT 20"`,
+		`psql -v ON_ERROR_STOP=1 -d dependency_track -c 'CREATE EXTENSION IF NOT EXISTS "pgcrypto"'`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(script, e) {
+			t.Fatalf("expected database script to contain %s, got:\n%s", e, script)
+		}
+	}
+
+	script = databaseScript(DatabaseArgs{Name: "keycloak", Owner: "keycloak"})
+	if !strings.Contains(script, "CONNECTION LIMIT -1") {
+		t.Errorf("expected no connection limit by default, got:\n%s", script)
+	}
+}
+
+func TestEnsureDatabase(t *testing.T) {
+	args := &ClusterArgs{Databases: []DatabaseArgs{{Name: "keycloak", Owner: "kc"}}}
+
+	args.EnsureDatabase(DatabaseArgs{Name: "keycloak"})
+	args.EnsureDatabase(DatabaseArgs{Name: "dependency_track"})
+
+	if len(args.Databases) != 2 {
+		t.Fatalf("expected 2 databases, got %+v", args.Databases)
+	}
+	if args.Databases[0].Owner != "kc" {
+		t.Errorf("expected the configured keycloak database to be kept, got %+v", args.Databases[0])
+	}
+	if args.Databases[1].Owner != "dependency_track" {
+		t.Errorf("expected the owner to default to the name, got %+v", args.Databases[1])
+	}
+}
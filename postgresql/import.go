@@ -0,0 +1,99 @@
+package postgresql
+
+import (
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strconv"
+)
+
+const (
+	importSecretName = "postgresql-import-source"
+	// importSourceName is the name of the external cluster that refers to the database to import from.
+	importSourceName = "import-source"
+)
+
+// ImportArgs bootstraps the cluster by importing databases from an existing PostgreSQL server with pg_dump and
+// pg_restore instead of creating an empty one. Like RecoveryArgs, this only has an effect when the cluster is created.
+type ImportArgs struct {
+	// Type is "microservice", which imports a single database into the app database, or "monolith", which imports
+	// several databases and roles as they are.
+	Type string `json:"type"`
+	// Databases are the databases to import. For the monolith type, "*" imports all of them.
+	Databases []string `json:"databases"`
+	// Roles are the roles to import with the monolith type. "*" imports all of them.
+	Roles []string `json:"roles"`
+	// Host is the address of the server, e.g. the service of a PostgreSQL pod running next to the cluster for testing.
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// User needs to be able to read the databases, for the monolith type it also needs to be able to read the roles.
+	User string `json:"user"`
+	// SSLMode is the sslmode of the connection, e.g. "require".
+	SSLMode  string             `json:"sslMode"`
+	Password pulumi.StringInput `json:"-"`
+}
+
+func createImportSecret(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) (*pulumiv1.Secret, error) {
+	return pulumiv1.NewSecret(
+		ctx,
+		importSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(importSecretName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			StringData: pulumi.StringMap{
+				"password": args.Import.Password,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
+
+// importSpec returns the fields of the cluster spec for importing databases.
+func importSpec(args *ClusterArgs) pulumi.Map {
+	if args.Import == nil {
+		return pulumi.Map{}
+	}
+
+	return initdbImportSpec(args.Import, importSourceName, importSecretName)
+}
+
+// initdbImportSpec returns the fields of the cluster spec for importing from the external cluster sourceName, with the
+// password in the secret secretName.
+func initdbImportSpec(imp *ImportArgs, sourceName string, secretName string) pulumi.Map {
+	importArgs := pulumi.Map{
+		"type":      pulumi.String(imp.Type),
+		"databases": pulumi.ToStringArray(imp.Databases),
+		"source": pulumi.Map{
+			"externalCluster": pulumi.String(sourceName),
+		},
+	}
+	if imp.Type == "monolith" {
+		importArgs["roles"] = pulumi.ToStringArray(imp.Roles)
+	}
+
+	return pulumi.Map{
+		"bootstrap": pulumi.Map{
+			"initdb": pulumi.Map{
+				"import": importArgs,
+			},
+		},
+		"externalClusters": pulumi.MapArray{
+			pulumi.Map{
+				"name": pulumi.String(sourceName),
+				"connectionParameters": pulumi.StringMap{
+					"host":    pulumi.String(imp.Host),
+					"port":    pulumi.String(strconv.Itoa(imp.Port)),
+					"user":    pulumi.String(imp.User),
+					"dbname":  pulumi.String("postgres"),
+					"sslmode": pulumi.String(imp.SSLMode),
+				},
+				"password": pulumi.Map{
+					"name": pulumi.String(secretName),
+					"key":  pulumi.String("password"),
+				},
+			},
+		},
+	}
+}
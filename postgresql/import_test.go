@@ -0,0 +1,50 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"testing"
+)
+
+func TestImportSpec(t *testing.T) {
+	if spec := importSpec(&ClusterArgs{}); len(spec) != 0 {
+		t.Fatalf("expected no import configuration without import args, got %v", spec)
+	}
+
+	args := &ClusterArgs{
+		Import: &ImportArgs{
+			Type:      "microservice",
+			Databases: []string{"ort_server"},
+			Roles:     []string{"ignored"},
+			Host:      "legacy-postgresql",
+			Port:      5432,
+			User:      "postgres",
+			SSLMode:   "disable",
+		},
+	}
+
+	spec := importSpec(args)
+
+	imp := spec["bootstrap"].(pulumi.Map)["initdb"].(pulumi.Map)["import"].(pulumi.Map)
+	if imp["type"] != pulumi.String("microservice") {
+		t.Errorf("unexpected import type: %v", imp["type"])
+	}
+	if _, ok := imp["roles"]; ok {
+		t.Error("expected no roles for the microservice type")
+	}
+	source := imp["source"].(pulumi.Map)["externalCluster"]
+	if source != pulumi.String(importSourceName) {
+		t.Errorf("unexpected import source: %v", source)
+	}
+
+	cluster := spec["externalClusters"].(pulumi.MapArray)[0].(pulumi.Map)
+	params := cluster["connectionParameters"].(pulumi.StringMap)
+	if params["host"] != pulumi.String("legacy-postgresql") || params["port"] != pulumi.String("5432") {
+		t.Errorf("unexpected connection parameters: %v", params)
+	}
+
+	args.Import.Type = "monolith"
+	imp = importSpec(args)["bootstrap"].(pulumi.Map)["initdb"].(pulumi.Map)["import"].(pulumi.Map)
+	if _, ok := imp["roles"]; !ok {
+		t.Error("expected roles for the monolith type")
+	}
+}
@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"os"
+)
+
+const queriesConfigMapName = "postgresql-ort-server-queries"
+
+// MonitoringArgs configures the metrics exporter of the PostgreSQL pods and a PodMonitor for the Prometheus Operator,
+// whose CRDs have to be installed in the cluster.
+type MonitoringArgs struct {
+	// PodMonitorLabels are added to the PodMonitor, e.g. to match the podMonitorSelector of the Prometheus resource.
+	// CloudNativePG copies them from the inherited metadata of the cluster, so they are added to the pods as well.
+	PodMonitorLabels map[string]string `json:"podMonitorLabels"`
+}
+
+// createQueriesConfigMap creates the ConfigMap with the custom queries in ort-server-queries.yaml.
+func createQueriesConfigMap(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) (*pulumiv1.ConfigMap, error) {
+	queries, err := os.ReadFile("./postgresql/ort-server-queries.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	return pulumiv1.NewConfigMap(
+		ctx,
+		queriesConfigMapName,
+		&pulumiv1.ConfigMapArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(queriesConfigMapName),
+				Namespace: args.Namespace.Metadata.Name(),
+				Labels: pulumi.StringMap{
+					"cnpg.io/reload": pulumi.String("true"),
+				},
+			},
+			Data: pulumi.StringMap{
+				"queries": pulumi.String(queries),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
+
+// monitoringSpec returns the fields of the cluster spec for monitoring.
+func monitoringSpec(args *ClusterArgs) pulumi.Map {
+	spec := pulumi.Map{}
+	if args.Monitoring == nil {
+		return spec
+	}
+
+	spec["monitoring"] = pulumi.Map{
+		"enablePodMonitor": pulumi.Bool(true),
+		"customQueriesConfigMap": pulumi.MapArray{
+			pulumi.Map{
+				"name": pulumi.String(queriesConfigMapName),
+				"key":  pulumi.String("queries"),
+			},
+		},
+	}
+
+	if len(args.Monitoring.PodMonitorLabels) > 0 {
+		spec["inheritedMetadata"] = pulumi.Map{
+			"labels": pulumi.ToStringMap(args.Monitoring.PodMonitorLabels),
+		}
+	}
+
+	return spec
+}
@@ -0,0 +1,30 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"testing"
+)
+
+func TestMonitoringSpec(t *testing.T) {
+	if spec := monitoringSpec(&ClusterArgs{}); len(spec) != 0 {
+		t.Fatalf("expected no monitoring configuration without monitoring args, got %v", spec)
+	}
+
+	spec := monitoringSpec(&ClusterArgs{
+		Monitoring: &MonitoringArgs{PodMonitorLabels: map[string]string{"release": "prometheus"}},
+	})
+
+	monitoring := spec["monitoring"].(pulumi.Map)
+	if monitoring["enablePodMonitor"] != pulumi.Bool(true) {
+		t.Errorf("expected the PodMonitor to be enabled, got %v", monitoring["enablePodMonitor"])
+	}
+	queries := monitoring["customQueriesConfigMap"].(pulumi.MapArray)[0].(pulumi.Map)
+	if queries["name"] != pulumi.String(queriesConfigMapName) {
+		t.Errorf("unexpected custom queries: %v", queries)
+	}
+
+	labels := spec["inheritedMetadata"].(pulumi.Map)["labels"].(pulumi.StringMap)
+	if labels["release"] != pulumi.String("prometheus") {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+}
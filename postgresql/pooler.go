@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strconv"
+)
+
+// PoolerArgs configures PgBouncer poolers in front of the primary and the replicas.
+type PoolerArgs struct {
+	// Instances is the number of PgBouncer pods per pooler.
+	Instances int `json:"instances"`
+	// PoolMode is "session" or "transaction". Transaction pooling requires clients that do not rely on server side
+	// prepared statements, e.g. JDBC with prepareThreshold=0.
+	PoolMode string `json:"poolMode"`
+	// DefaultPoolSize is the number of server connections per user and database.
+	DefaultPoolSize int `json:"defaultPoolSize"`
+	// MaxClientConnections is the number of client connections a PgBouncer pod accepts.
+	MaxClientConnections int `json:"maxClientConnections"`
+}
+
+// createPooler creates a pooler of the given type ("rw" or "ro") and returns the name of its service.
+func createPooler(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+	poolerType string,
+) (pulumi.StringOutput, error) {
+	name := "postgresql-pooler-" + poolerType
+	pooler, err := apiextensions.NewCustomResource(ctx, name,
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("postgresql.cnpg.io/v1"),
+			Kind:       pulumi.String("Pooler"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(name),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": poolerSpec(args.Pooler, poolerType, component.cluster.Metadata.Name().Elem()),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// The operator names the service after the pooler.
+	return pooler.Metadata.Name().Elem(), nil
+}
+
+func poolerSpec(pooler *PoolerArgs, poolerType string, clusterName pulumi.StringInput) pulumi.Map {
+	return pulumi.Map{
+		"cluster": pulumi.Map{
+			"name": clusterName,
+		},
+		"instances": pulumi.Int(pooler.Instances),
+		"type":      pulumi.String(poolerType),
+		"pgbouncer": pulumi.Map{
+			"poolMode": pulumi.String(pooler.PoolMode),
+			// PgBouncer expects all parameters as strings.
+			"parameters": pulumi.StringMap{
+				"default_pool_size": pulumi.String(strconv.Itoa(pooler.DefaultPoolSize)),
+				"max_client_conn":   pulumi.String(strconv.Itoa(pooler.MaxClientConnections)),
+			},
+		},
+	}
+}
@@ -1,11 +1,13 @@
 package postgresql
 
 import (
+	"fmt"
 	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
 	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml"
-	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	corev1 "k8s.io/api/core/v1"
 	"time"
@@ -14,13 +16,78 @@ import (
 type Cluster struct {
 	pulumi.ResourceState
 
-	keycloakSecret   *pulumiv1.Secret
+	// Host is the name of the service pointing to the primary instance.
+	Host pulumi.StringOutput
+	// ReadOnlyHost is the name of the service pointing to the replicas.
+	ReadOnlyHost pulumi.StringOutput
+	// PoolerHost is the name of the service pointing to the read-write pooler, or Host if pooling is disabled.
+	PoolerHost pulumi.StringOutput
+	// PoolerReadOnlyHost is the name of the service pointing to the read-only pooler, or ReadOnlyHost if pooling is
+	// disabled.
+	PoolerReadOnlyHost pulumi.StringOutput
+	Port               pulumi.IntOutput
+	// AppDatabase is the name of the database created by CloudNativePG for applications.
+	AppDatabase pulumi.StringOutput
+	// AppSecretName is the name of the secret holding the credentials of the owner of AppDatabase. It also contains the
+	// keys host, port, dbname and uri.
+	AppSecretName pulumi.StringOutput
+	// Databases holds the outputs for ClusterArgs.Databases, keyed by database name.
+	Databases map[string]Database
+
 	operatorManifest *yaml.ConfigFile
-	clusterManifest  *yaml.ConfigFile
+	cluster          *apiextensions.CustomResource
+	// previousCluster is the cluster replaced by a major version upgrade, nil if there is no upgrade in progress.
+	previousCluster *apiextensions.CustomResource
+	databases       []*database
 }
 
 type ClusterArgs struct {
 	Namespace *pulumiv1.Namespace
+	// Stack references the outputs of the last update, see common.NewSelfReference. The deployed cluster is read from
+	// it.
+	Stack *pulumi.StackReference
+	// MajorVersion is the PostgreSQL major version. Changing it requires Upgrade.
+	MajorVersion int
+	// ImageName is the PostgreSQL image. Its tag has to start with MajorVersion.
+	ImageName string
+	// Upgrade allows changing MajorVersion by creating a new cluster that imports the databases of the old one. The old
+	// cluster is kept until Upgrade is unset again.
+	Upgrade     bool
+	Instances   int
+	StorageSize string
+	// StorageClass is used for the data and the WAL volumes. The default storage class is used if it is empty.
+	StorageClass string
+	// WALStorageSize is the size of a separate volume for the WAL. The WAL is stored on the data volume if it is empty.
+	WALStorageSize string
+	Resources      Resources
+	// Parameters are set in postgresql.conf.
+	Parameters map[string]string
+	// Databases are created in addition to the app database created by CloudNativePG, each with its own owner role.
+	Databases []DatabaseArgs
+	// Backup enables continuous backups if not nil.
+	Backup *BackupArgs
+	// Recovery bootstraps the cluster from a backup if not nil. It requires Backup.
+	Recovery *RecoveryArgs
+	// Import bootstraps the cluster from an existing PostgreSQL server if not nil. It excludes Recovery.
+	Import *ImportArgs
+	// Pooler creates PgBouncer poolers if not nil.
+	Pooler *PoolerArgs
+	// Monitoring enables the PodMonitor and the custom queries for ORT Server if not nil.
+	Monitoring *MonitoringArgs
+}
+
+// EnsureDatabase adds db to the databases unless a database with the same name is already configured.
+func (args *ClusterArgs) EnsureDatabase(db DatabaseArgs) {
+	for _, existing := range args.Databases {
+		if existing.Name == db.Name {
+			return
+		}
+	}
+
+	if db.Owner == "" {
+		db.Owner = db.Name
+	}
+	args.Databases = append(args.Databases, db)
 }
 
 func NewCluster(
@@ -36,12 +103,53 @@ func NewCluster(
 		return nil, err
 	}
 
-	var keycloakPassword *random.RandomPassword
-	keycloakPassword, component.keycloakSecret, err = createKeycloakSecret(ctx, component)
+	deployed, err := readDeployedCluster(args)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := planClusters(deployed, args)
 	if err != nil {
 		return nil, err
 	}
 
+	managedRoles := pulumi.MapArray{}
+	dependencies := []pulumi.Resource{}
+	for _, dbArgs := range args.Databases {
+		db := &database{args: dbArgs}
+		if err := createRoleSecret(ctx, component, db); err != nil {
+			return nil, err
+		}
+
+		component.databases = append(component.databases, db)
+		managedRoles = append(managedRoles, managedRole(db))
+		dependencies = append(dependencies, db.secret)
+	}
+
+	if args.Backup != nil {
+		backupSecret, err := createBackupSecret(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, backupSecret)
+	}
+
+	if args.Import != nil {
+		importSecret, err := createImportSecret(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, importSecret)
+	}
+
+	if args.Monitoring != nil {
+		queries, err := createQueriesConfigMap(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, queries)
+	}
+
 	component.operatorManifest, err = yaml.NewConfigFile(ctx, "cnpg-operator",
 		&yaml.ConfigFileArgs{
 			File: "./postgresql/cnpg-1.23.1.yaml",
@@ -63,56 +171,158 @@ func NewCluster(
 		}, time.Minute)
 	}
 
-	component.clusterManifest, err = yaml.NewConfigFile(ctx, "postgresql-cluster",
-		&yaml.ConfigFileArgs{
-			File: "./postgresql/cluster.yaml",
-		},
-		pulumi.DependsOn([]pulumi.Resource{component.keycloakSecret}),
-		pulumi.ResourceOption(pulumi.Parent(component)),
-	)
+	dependencies = append(dependencies, component.operatorManifest)
+	spec := clusterSpec(args, active.Name, active.ImageName, managedRoles)
+
+	if previous := active.Previous; previous != nil {
+		previousSpec := clusterSpec(args, previous.Name, previous.ImageName, managedRoles)
+		// The new cluster imports the databases and roles as superuser.
+		previousSpec["enableSuperuserAccess"] = pulumi.Bool(true)
+
+		component.previousCluster, err = newClusterResource(ctx, component, args, previous.Name, previousSpec, dependencies)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, value := range upgradeImportSpec(previous) {
+			spec[key] = value
+		}
+		dependencies = append(dependencies, component.previousCluster)
+	} else {
+		for key, value := range importSpec(args) {
+			spec[key] = value
+		}
+	}
+
+	component.cluster, err = newClusterResource(ctx, component, args, active.Name, spec, dependencies)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx.Export("keycloak-postgresql-password", keycloakPassword.Result)
+	if args.Backup != nil {
+		if err := createScheduledBackup(ctx, component, args); err != nil {
+			return nil, err
+		}
+	}
+
+	clusterName := component.cluster.Metadata.Name().Elem()
+	component.Host = pulumi.Sprintf("%s-rw", clusterName)
+
+	component.Databases = make(map[string]Database)
+	databaseOutputs := pulumi.Map{}
+	for _, db := range component.databases {
+		db.job, err = newDatabaseJob(ctx, component, db, component.Host, active.ImageName, args.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		name := db.args.Name
+		component.Databases[name] = Database{
+			// Deriving the name from the job makes resources using it wait until the database exists.
+			Name: db.job.Metadata.Name().ApplyT(func(_ *string) string {
+				return name
+			}).(pulumi.StringOutput),
+			SecretName: db.secret.Metadata.Name().Elem(),
+		}
+		databaseOutputs[name] = pulumi.Map{
+			"name":       component.Databases[name].Name,
+			"secretName": component.Databases[name].SecretName,
+		}
+	}
+
+	component.ReadOnlyHost = pulumi.Sprintf("%s-ro", clusterName)
+	component.PoolerHost = component.Host
+	component.PoolerReadOnlyHost = component.ReadOnlyHost
+
+	if args.Pooler != nil {
+		component.PoolerHost, err = createPooler(ctx, component, args, "rw")
+		if err != nil {
+			return nil, err
+		}
+
+		component.PoolerReadOnlyHost, err = createPooler(ctx, component, args, "ro")
+		if err != nil {
+			return nil, err
+		}
+	}
+	component.Port = pulumi.Int(5432).ToIntOutput()
+	component.AppDatabase = pulumi.String("app").ToStringOutput()
+	component.AppSecretName = pulumi.Sprintf("%s-app", clusterName)
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"host":               component.Host,
+		"readOnlyHost":       component.ReadOnlyHost,
+		"poolerHost":         component.PoolerHost,
+		"poolerReadOnlyHost": component.PoolerReadOnlyHost,
+		"port":               component.Port,
+		"appDatabase":        component.AppDatabase,
+		"appSecretName":      component.AppSecretName,
+		"databases":          databaseOutputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, db := range component.databases {
+		ctx.Export(fmt.Sprintf("%s-postgresql-password", kubernetesName(db.args.Owner)), db.password.Result)
+	}
+	ctx.Export("postgresql-cluster", active.toOutput())
+
 	return component, nil
 }
 
-func createKeycloakSecret(ctx *pulumi.Context, component *Cluster) (*random.RandomPassword, *pulumiv1.Secret, error) {
-	password, err := random.NewRandomPassword(
-		ctx,
-		"keycloak-postgresql-password",
-		&random.RandomPasswordArgs{
-			Length: pulumi.Int(16),
+// clusterSpec returns the spec of the cluster with the given name, without bootstrap configuration besides recovery.
+func clusterSpec(args *ClusterArgs, name string, imageName string, managedRoles pulumi.MapArray) pulumi.Map {
+	spec := pulumi.Map{
+		"instances": pulumi.Int(args.Instances),
+		"imageName": pulumi.String(imageName),
+		"managed": pulumi.Map{
+			"roles": managedRoles,
 		},
-		pulumi.ResourceOption(pulumi.Parent(component)),
-	)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	secret, err := pulumiv1.NewSecret(
-		ctx,
-		"keycloak-tls",
-		&pulumiv1.SecretArgs{
-			Metadata: pulumimetav1.ObjectMetaArgs{
-				Name:      pulumi.String("postgresql-keycloak"),
-				Namespace: pulumi.String("ort-server"),
-				Labels: pulumi.StringMap{
-					"cnpg.io/reload": pulumi.String("true"),
-				},
+	}
+
+	for key, value := range sizingSpec(args) {
+		spec[key] = value
+	}
+	if args.Backup != nil {
+		for key, value := range backupSpec(args, backupServerName(args.Backup, name)) {
+			spec[key] = value
+		}
+	}
+	for key, value := range monitoringSpec(args) {
+		spec[key] = value
+	}
+
+	return spec
+}
+
+func newClusterResource(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+	name string,
+	spec pulumi.Map,
+	dependencies []pulumi.Resource,
+) (*apiextensions.CustomResource, error) {
+	opts := []pulumi.ResourceOption{pulumi.DependsOn(dependencies), pulumi.Parent(component)}
+	if name == initialClusterName {
+		// The first cluster used to be created from postgresql/cluster.yaml.
+		alias := common.ConfigFileAlias(ctx, component.URN(), "postgresql-cluster", "ort-server/"+name)
+		opts = append(opts, pulumi.Aliases([]pulumi.Alias{alias}))
+	}
+
+	return apiextensions.NewCustomResource(ctx, clusterResourceName(name),
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("postgresql.cnpg.io/v1"),
+			Kind:       pulumi.String("Cluster"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(name),
+				Namespace: args.Namespace.Metadata.Name(),
 			},
-			Type: pulumi.String("kubernetes.io/basic-auth"),
-			StringData: pulumi.StringMap{
-				"username": pulumi.String("keycloak"),
-				"password": password.Result,
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": spec,
 			},
 		},
-		pulumi.ResourceOption(pulumi.Parent(component)),
+		opts...,
 	)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return password, secret, nil
 }
@@ -0,0 +1,162 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"maps"
+)
+
+// Resources holds the compute resources of the PostgreSQL pods. Empty values are omitted.
+type Resources struct {
+	CPURequest    string `json:"cpuRequest"`
+	CPULimit      string `json:"cpuLimit"`
+	MemoryRequest string `json:"memoryRequest"`
+	MemoryLimit   string `json:"memoryLimit"`
+}
+
+// sizePreset holds the defaults for one of the values of the "postgresql:size" configuration key. The parameters assume
+// that PostgreSQL has the memory limit to itself: shared_buffers is a quarter of it and effective_cache_size three
+// quarters.
+type sizePreset struct {
+	resources      Resources
+	parameters     map[string]string
+	storageSize    string
+	walStorageSize string
+}
+
+var sizePresets = map[string]sizePreset{
+	"small": {
+		resources: Resources{CPURequest: "250m", MemoryRequest: "1Gi", MemoryLimit: "1Gi"},
+		parameters: map[string]string{
+			"shared_buffers":       "256MB",
+			"effective_cache_size": "768MB",
+			"work_mem":             "4MB",
+			"maintenance_work_mem": "64MB",
+			"max_connections":      "100",
+		},
+		storageSize: "5Gi",
+	},
+	"medium": {
+		resources: Resources{CPURequest: "1", CPULimit: "2", MemoryRequest: "4Gi", MemoryLimit: "4Gi"},
+		parameters: map[string]string{
+			"shared_buffers":       "1GB",
+			"effective_cache_size": "3GB",
+			"work_mem":             "8MB",
+			"maintenance_work_mem": "256MB",
+			"max_connections":      "200",
+		},
+		storageSize:    "20Gi",
+		walStorageSize: "5Gi",
+	},
+	"large": {
+		resources: Resources{CPURequest: "4", CPULimit: "8", MemoryRequest: "16Gi", MemoryLimit: "16Gi"},
+		parameters: map[string]string{
+			"shared_buffers":       "4GB",
+			"effective_cache_size": "12GB",
+			"work_mem":             "16MB",
+			"maintenance_work_mem": "1GB",
+			"max_connections":      "400",
+		},
+		storageSize:    "100Gi",
+		walStorageSize: "20Gi",
+	},
+}
+
+// fixedParameters are the PostgreSQL parameters managed by CloudNativePG, which rejects clusters setting them.
+var fixedParameters = []string{
+	"archive_command",
+	"archive_mode",
+	"cluster_name",
+	"config_file",
+	"data_directory",
+	"hba_file",
+	"hot_standby",
+	"ident_file",
+	"listen_addresses",
+	"log_destination",
+	"log_directory",
+	"log_filename",
+	"logging_collector",
+	"port",
+	"primary_conninfo",
+	"primary_slot_name",
+	"restore_command",
+	"ssl",
+	"ssl_ca_file",
+	"ssl_cert_file",
+	"ssl_key_file",
+	"unix_socket_directories",
+	"wal_level",
+}
+
+// mergeParameters returns the preset parameters overridden by the configured ones.
+func mergeParameters(preset map[string]string, configured map[string]string) map[string]string {
+	merged := maps.Clone(preset)
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	maps.Copy(merged, configured)
+	return merged
+}
+
+// sizingSpec returns the fields of the cluster spec for storage, resources and PostgreSQL parameters.
+func sizingSpec(args *ClusterArgs) pulumi.Map {
+	storage := pulumi.Map{
+		"size": pulumi.String(args.StorageSize),
+	}
+	if args.StorageClass != "" {
+		storage["storageClass"] = pulumi.String(args.StorageClass)
+	}
+
+	spec := pulumi.Map{
+		"storage": storage,
+	}
+
+	if args.WALStorageSize != "" {
+		walStorage := pulumi.Map{
+			"size": pulumi.String(args.WALStorageSize),
+		}
+		if args.StorageClass != "" {
+			walStorage["storageClass"] = pulumi.String(args.StorageClass)
+		}
+		spec["walStorage"] = walStorage
+	}
+
+	if resources := resourcesSpec(args.Resources); len(resources) > 0 {
+		spec["resources"] = resources
+	}
+
+	if len(args.Parameters) > 0 {
+		spec["postgresql"] = pulumi.Map{
+			"parameters": pulumi.ToStringMap(args.Parameters),
+		}
+	}
+
+	return spec
+}
+
+func resourcesSpec(r Resources) pulumi.Map {
+	spec := pulumi.Map{}
+
+	requests := quantities(r.CPURequest, r.MemoryRequest)
+	if len(requests) > 0 {
+		spec["requests"] = requests
+	}
+
+	limits := quantities(r.CPULimit, r.MemoryLimit)
+	if len(limits) > 0 {
+		spec["limits"] = limits
+	}
+
+	return spec
+}
+
+func quantities(cpu string, memory string) pulumi.StringMap {
+	q := pulumi.StringMap{}
+	if cpu != "" {
+		q["cpu"] = pulumi.String(cpu)
+	}
+	if memory != "" {
+		q["memory"] = pulumi.String(memory)
+	}
+	return q
+}
@@ -0,0 +1,55 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"testing"
+)
+
+func TestSizingSpec(t *testing.T) {
+	preset := sizePresets["medium"]
+	args := &ClusterArgs{
+		StorageSize:    preset.storageSize,
+		StorageClass:   "fast-ssd",
+		WALStorageSize: preset.walStorageSize,
+		Resources:      preset.resources,
+		Parameters:     mergeParameters(preset.parameters, map[string]string{"shared_buffers": "2GB"}),
+	}
+
+	spec := sizingSpec(args)
+
+	storage := spec["storage"].(pulumi.Map)
+	if storage["size"] != pulumi.String("20Gi") || storage["storageClass"] != pulumi.String("fast-ssd") {
+		t.Errorf("unexpected storage: %v", storage)
+	}
+
+	walStorage := spec["walStorage"].(pulumi.Map)
+	if walStorage["size"] != pulumi.String("5Gi") || walStorage["storageClass"] != pulumi.String("fast-ssd") {
+		t.Errorf("unexpected WAL storage: %v", walStorage)
+	}
+
+	limits := spec["resources"].(pulumi.Map)["limits"].(pulumi.StringMap)
+	if limits["memory"] != pulumi.String("4Gi") {
+		t.Errorf("unexpected limits: %v", limits)
+	}
+
+	parameters := spec["postgresql"].(pulumi.Map)["parameters"].(pulumi.StringMap)
+	if parameters["shared_buffers"] != pulumi.String("2GB") {
+		t.Errorf("expected the configured shared_buffers to override the preset, got %v", parameters["shared_buffers"])
+	}
+	if parameters["max_connections"] != pulumi.String("200") {
+		t.Errorf("expected max_connections from the preset, got %v", parameters["max_connections"])
+	}
+}
+
+func TestSizingSpecDefaults(t *testing.T) {
+	spec := sizingSpec(&ClusterArgs{StorageSize: "1Gi", Parameters: mergeParameters(nil, nil)})
+
+	for _, key := range []string{"walStorage", "resources", "postgresql"} {
+		if _, ok := spec[key]; ok {
+			t.Errorf("expected no %s without configuration, got %v", key, spec[key])
+		}
+	}
+	if _, ok := spec["storage"].(pulumi.Map)["storageClass"]; ok {
+		t.Error("expected the default storage class to be used")
+	}
+}
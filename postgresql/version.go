@@ -0,0 +1,170 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMajorVersion = 16
+	// initialClusterName is the name of the cluster until the first major version upgrade. Clusters created by an
+	// upgrade are named after their major version, e.g. "postgresql-17".
+	initialClusterName = "postgresql"
+	// upgradeSourceName is the name of the external cluster that refers to the cluster replaced by an upgrade.
+	upgradeSourceName = "upgrade-source"
+)
+
+// defaultImages pins the PostgreSQL image per major version. 16.3 is the default of CloudNativePG 1.23.1, which was
+// used before the image was configurable.
+var defaultImages = map[int]string{
+	13: "ghcr.io/cloudnative-pg/postgresql:13.15",
+	14: "ghcr.io/cloudnative-pg/postgresql:14.12",
+	15: "ghcr.io/cloudnative-pg/postgresql:15.7",
+	16: "ghcr.io/cloudnative-pg/postgresql:16.3",
+}
+
+// deployedCluster describes a cluster as exported in "postgresql-cluster".
+type deployedCluster struct {
+	Name         string `json:"name"`
+	MajorVersion int    `json:"majorVersion"`
+	ImageName    string `json:"imageName"`
+	// Previous is the cluster replaced by a major version upgrade. It is kept until ClusterArgs.Upgrade is unset.
+	Previous *deployedCluster `json:"previous,omitempty"`
+}
+
+// imageMajorVersion returns the major version from the tag of a PostgreSQL image, e.g. 16 for
+// "ghcr.io/cloudnative-pg/postgresql:16.3-1".
+func imageMajorVersion(image string) (int, error) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return 0, fmt.Errorf("image %q has no tag", image)
+	}
+
+	tag := image[i+1:]
+	major, _, _ := strings.Cut(tag, ".")
+	version, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("the tag of image %q does not start with the major version", image)
+	}
+
+	return version, nil
+}
+
+// readDeployedCluster returns the cluster exported by the previous update. If there is none, the stack is either new
+// or was deployed before the export existed, so the configured version is assumed. CloudNativePG itself refuses
+// changing the major version of an existing cluster in the latter case.
+func readDeployedCluster(args *ClusterArgs) (deployedCluster, error) {
+	current := deployedCluster{Name: initialClusterName, MajorVersion: args.MajorVersion, ImageName: args.ImageName}
+
+	details, err := args.Stack.GetOutputDetails("postgresql-cluster")
+	if err != nil {
+		return deployedCluster{}, err
+	}
+	if details.Value == nil {
+		return current, nil
+	}
+
+	data, err := json.Marshal(details.Value)
+	if err != nil {
+		return deployedCluster{}, err
+	}
+
+	var deployed deployedCluster
+	if err := json.Unmarshal(data, &deployed); err != nil {
+		return deployedCluster{}, fmt.Errorf("readDeployedCluster: %w", err)
+	}
+
+	return deployed, nil
+}
+
+// planClusters returns the cluster to deploy, with Previous set to the cluster to keep running next to it during a
+// major version upgrade. Changing the major version creates a new cluster that imports the databases of the deployed
+// one, because PostgreSQL data directories cannot be upgraded in place.
+func planClusters(deployed deployedCluster, args *ClusterArgs) (deployedCluster, error) {
+	active := deployedCluster{Name: deployed.Name, MajorVersion: args.MajorVersion, ImageName: args.ImageName}
+
+	if args.MajorVersion == deployed.MajorVersion {
+		if args.Upgrade {
+			active.Previous = deployed.Previous
+		}
+		return active, nil
+	}
+
+	if args.MajorVersion < deployed.MajorVersion {
+		return deployedCluster{}, fmt.Errorf(
+			"postgresql:majorVersion cannot be downgraded from %d to %d",
+			deployed.MajorVersion,
+			args.MajorVersion,
+		)
+	}
+
+	if !args.Upgrade {
+		return deployedCluster{}, fmt.Errorf(
+			"postgresql:majorVersion changed from %d to %d, which cannot be done in place. Set postgresql:upgrade to "+
+				"true to import the databases into a new cluster %s-%d, and unset it once the new cluster works to "+
+				"delete the old one",
+			deployed.MajorVersion,
+			args.MajorVersion,
+			initialClusterName,
+			args.MajorVersion,
+		)
+	}
+
+	if deployed.Previous != nil {
+		return deployedCluster{}, fmt.Errorf(
+			"the upgrade from PostgreSQL %d is not finished, unset postgresql:upgrade to delete cluster %s first",
+			deployed.Previous.MajorVersion,
+			deployed.Previous.Name,
+		)
+	}
+
+	previous := deployed
+	active.Name = fmt.Sprintf("%s-%d", initialClusterName, args.MajorVersion)
+	active.Previous = &previous
+	return active, nil
+}
+
+// clusterResourceName returns the Pulumi resource name of a cluster. The first cluster keeps the resource name it had
+// before upgrades were supported.
+func clusterResourceName(name string) string {
+	return strings.Replace(name, initialClusterName, "postgresql-cluster", 1)
+}
+
+// backupServerName returns the server name of a cluster in the object store. Clusters created by an upgrade must not
+// archive into the directory of the cluster they replace.
+func backupServerName(backup *BackupArgs, name string) string {
+	return backup.ServerName + strings.TrimPrefix(name, initialClusterName)
+}
+
+// upgradeImportSpec returns the fields of the cluster spec for importing all databases and roles from the cluster
+// replaced by an upgrade. The replaced cluster exposes its superuser for this, see NewCluster.
+func upgradeImportSpec(previous *deployedCluster) pulumi.Map {
+	return initdbImportSpec(
+		&ImportArgs{
+			Type:      "monolith",
+			Databases: []string{"*"},
+			Roles:     []string{"*"},
+			Host:      previous.Name + "-rw",
+			Port:      5432,
+			User:      "postgres",
+			SSLMode:   "require",
+		},
+		upgradeSourceName,
+		previous.Name+"-superuser",
+	)
+}
+
+func (d deployedCluster) toOutput() pulumi.Map {
+	output := pulumi.Map{
+		"name":         pulumi.String(d.Name),
+		"majorVersion": pulumi.Int(d.MajorVersion),
+		"imageName":    pulumi.String(d.ImageName),
+	}
+	if d.Previous != nil {
+		output["previous"] = d.Previous.toOutput()
+	}
+	return output
+}
@@ -0,0 +1,131 @@
+package postgresql
+
+import (
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+	"testing"
+)
+
+func TestImageMajorVersion(t *testing.T) {
+	for image, expected := range map[string]int{
+		"ghcr.io/cloudnative-pg/postgresql:16.3":   16,
+		"ghcr.io/cloudnative-pg/postgresql:17.0-1": 17,
+		"registry:5000/postgresql:15":              15,
+	} {
+		major, err := imageMajorVersion(image)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", image, err)
+		} else if major != expected {
+			t.Errorf("expected major version %d for %s, got %d", expected, image, major)
+		}
+	}
+
+	for _, image := range []string{"postgresql", "registry:5000/postgresql", "postgresql:latest"} {
+		if _, err := imageMajorVersion(image); err == nil {
+			t.Errorf("expected an error for %s", image)
+		}
+	}
+}
+
+func TestPlanClustersSameVersion(t *testing.T) {
+	deployed := deployedCluster{Name: "postgresql", MajorVersion: 16, ImageName: defaultImages[16]}
+	args := &ClusterArgs{MajorVersion: 16, ImageName: "ghcr.io/cloudnative-pg/postgresql:16.4"}
+
+	active, err := planClusters(deployed, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.Name != "postgresql" || active.ImageName != args.ImageName || active.Previous != nil {
+		t.Errorf("expected the deployed cluster with the new image, got %+v", active)
+	}
+}
+
+func TestPlanClustersRefusesInPlaceUpgrade(t *testing.T) {
+	deployed := deployedCluster{Name: "postgresql", MajorVersion: 16, ImageName: defaultImages[16]}
+	args := &ClusterArgs{MajorVersion: 17, ImageName: "ghcr.io/cloudnative-pg/postgresql:17.0"}
+
+	_, err := planClusters(deployed, args)
+	if err == nil || !strings.Contains(err.Error(), "postgresql:upgrade") {
+		t.Errorf("expected an error mentioning postgresql:upgrade, got %v", err)
+	}
+
+	args.MajorVersion = 15
+	if _, err := planClusters(deployed, args); err == nil {
+		t.Error("expected a downgrade to fail")
+	}
+}
+
+func TestPlanClustersUpgrade(t *testing.T) {
+	deployed := deployedCluster{Name: "postgresql", MajorVersion: 16, ImageName: defaultImages[16]}
+	args := &ClusterArgs{MajorVersion: 17, ImageName: "ghcr.io/cloudnative-pg/postgresql:17.0", Upgrade: true}
+
+	active, err := planClusters(deployed, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.Name != "postgresql-17" {
+		t.Errorf("expected a new cluster postgresql-17, got %s", active.Name)
+	}
+	if active.Previous == nil || *active.Previous != deployed {
+		t.Fatalf("expected the deployed cluster to be kept, got %+v", active.Previous)
+	}
+
+	// The next update keeps both clusters while upgrade is set and deletes the old one once it is unset.
+	upgraded, err := planClusters(active, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgraded.Name != "postgresql-17" || upgraded.Previous == nil {
+		t.Errorf("expected the old cluster to be kept while upgrading, got %+v", upgraded)
+	}
+
+	args.Upgrade = false
+	retired, err := planClusters(upgraded, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retired.Name != "postgresql-17" || retired.Previous != nil {
+		t.Errorf("expected the old cluster to be deleted, got %+v", retired)
+	}
+
+	args.MajorVersion = 18
+	args.ImageName = "ghcr.io/cloudnative-pg/postgresql:18.0"
+	args.Upgrade = true
+	if _, err := planClusters(upgraded, args); err == nil {
+		t.Error("expected an upgrade to fail while the previous one is not finished")
+	}
+}
+
+func TestClusterNames(t *testing.T) {
+	if name := clusterResourceName("postgresql"); name != "postgresql-cluster" {
+		t.Errorf("unexpected resource name of the first cluster: %s", name)
+	}
+	if name := clusterResourceName("postgresql-17"); name != "postgresql-cluster-17" {
+		t.Errorf("unexpected resource name of an upgraded cluster: %s", name)
+	}
+
+	backup := &BackupArgs{ServerName: "prod"}
+	if name := backupServerName(backup, "postgresql"); name != "prod" {
+		t.Errorf("unexpected server name of the first cluster: %s", name)
+	}
+	if name := backupServerName(backup, "postgresql-17"); name != "prod-17" {
+		t.Errorf("unexpected server name of an upgraded cluster: %s", name)
+	}
+}
+
+func TestUpgradeImportSpec(t *testing.T) {
+	spec := upgradeImportSpec(&deployedCluster{Name: "postgresql", MajorVersion: 16})
+
+	imp := spec["bootstrap"].(pulumi.Map)["initdb"].(pulumi.Map)["import"].(pulumi.Map)
+	if imp["type"] != pulumi.String("monolith") {
+		t.Errorf("unexpected import type: %v", imp["type"])
+	}
+
+	cluster := spec["externalClusters"].(pulumi.MapArray)[0].(pulumi.Map)
+	if host := cluster["connectionParameters"].(pulumi.StringMap)["host"]; host != pulumi.String("postgresql-rw") {
+		t.Errorf("expected to import from the old cluster, got %v", host)
+	}
+	if secret := cluster["password"].(pulumi.Map)["name"]; secret != pulumi.String("postgresql-superuser") {
+		t.Errorf("expected the superuser secret of the old cluster, got %v", secret)
+	}
+}
@@ -0,0 +1,22 @@
+package rabbitmq
+
+import (
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// LoadClusterArgs reads the "rabbitmq:*" keys from the stack configuration.
+func LoadClusterArgs(ctx *pulumi.Context, namespace *pulumiv1.Namespace) (*ClusterArgs, error) {
+	cfg := common.NewConfig(ctx, "rabbitmq")
+
+	args := &ClusterArgs{
+		Namespace: namespace,
+		Replicas:  cfg.Int("replicas", 3),
+		Image:     cfg.String("image", ""),
+	}
+
+	cfg.Positive("replicas", args.Replicas)
+
+	return args, cfg.Err()
+}
@@ -1,8 +1,12 @@
 package rabbitmq
 
 import (
+	"github.com/haikoschol/ort-server-pulumi-go/certmanager"
 	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
+	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apiextensions"
 	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	corev1 "k8s.io/api/core/v1"
@@ -12,12 +16,31 @@ import (
 type Cluster struct {
 	pulumi.ResourceState
 
+	// Host is the name of the client service.
+	Host pulumi.StringOutput
+	Port pulumi.IntOutput
+	// URI is the AMQP URI of the client service.
+	URI pulumi.StringOutput
+	// DefaultUserSecretName is the name of the secret holding the credentials of the default user. It contains the keys
+	// username and password.
+	DefaultUserSecretName pulumi.StringOutput
+	// TLSURI is the AMQPS URI of the client service. It is empty if TLS is disabled.
+	TLSURI pulumi.StringOutput
+	// CASecretName is the name of the secret containing the CA certificate ("ca.crt") clients use to verify RabbitMQ's
+	// certificate. It is empty if TLS is disabled.
+	CASecretName pulumi.StringOutput
+
 	operatorManifest *yaml.ConfigFile
-	clusterManifest  *yaml.ConfigFile
+	cluster          *apiextensions.CustomResource
 }
 
 type ClusterArgs struct {
 	Namespace *pulumiv1.Namespace
+	Replicas  int
+	// Image overrides the RabbitMQ image chosen by the operator if not empty.
+	Image string
+	// Issuer enables an additional AMQPS listener with a certificate issued by cert-manager if not nil.
+	Issuer *certmanager.Issuer
 }
 
 func NewCluster(
@@ -54,15 +77,73 @@ func NewCluster(
 		}, time.Minute)
 	}
 
-	component.clusterManifest, err = yaml.NewConfigFile(ctx, "rabbitmq-cluster",
-		&yaml.ConfigFileArgs{
-			File: "./rabbitmq/cluster.yaml",
+	spec := pulumi.Map{
+		"replicas": pulumi.Int(args.Replicas),
+	}
+	if args.Image != "" {
+		spec["image"] = pulumi.String(args.Image)
+	}
+
+	dependencies := []pulumi.Resource{component.operatorManifest}
+	component.TLSURI = pulumi.String("").ToStringOutput()
+	component.CASecretName = pulumi.String("").ToStringOutput()
+
+	if args.Issuer != nil {
+		tlsDependencies, err := createTLS(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, tlsDependencies...)
+
+		spec["tls"] = pulumi.Map{
+			"secretName": pulumi.String(tlsSecretName),
+		}
+		component.CASecretName = pulumi.String(tlsCASecretName).ToStringOutput()
+	}
+
+	component.cluster, err = apiextensions.NewCustomResource(ctx, "rabbitmq-cluster",
+		&apiextensions.CustomResourceArgs{
+			ApiVersion: pulumi.String("rabbitmq.com/v1beta1"),
+			Kind:       pulumi.String("RabbitmqCluster"),
+			Metadata: &pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String("rabbitmq"),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			OtherFields: kubernetes.UntypedArgs{
+				"spec": spec,
+			},
 		},
+		pulumi.DependsOn(dependencies),
 		pulumi.ResourceOption(pulumi.Parent(component)),
+		// The cluster used to be created from rabbitmq/cluster.yaml.
+		pulumi.Aliases([]pulumi.Alias{
+			common.ConfigFileAlias(ctx, component.URN(), "rabbitmq-cluster", "ort-server/rabbitmq"),
+		}),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	clusterName := component.cluster.Metadata.Name().Elem()
+	component.Host = clusterName
+	component.Port = pulumi.Int(5672).ToIntOutput()
+	component.URI = pulumi.Sprintf("amqp://%s:%d", component.Host, component.Port)
+	component.DefaultUserSecretName = pulumi.Sprintf("%s-default-user", clusterName)
+	if args.Issuer != nil {
+		component.TLSURI = pulumi.Sprintf("amqps://%s:%d", component.Host, tlsPort)
+	}
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"host":                  component.Host,
+		"port":                  component.Port,
+		"uri":                   component.URI,
+		"defaultUserSecretName": component.DefaultUserSecretName,
+		"tlsURI":                component.TLSURI,
+		"caSecretName":          component.CASecretName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return component, nil
 }
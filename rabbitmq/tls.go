@@ -0,0 +1,71 @@
+package rabbitmq
+
+import (
+	"github.com/haikoschol/ort-server-pulumi-go/certmanager"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	tlsSecretName   = "rabbitmq-tls"
+	tlsCASecretName = "rabbitmq-tls-ca"
+	// tlsPort is the port of the AMQPS listener the operator adds to the client service.
+	tlsPort = 5671
+)
+
+// createTLS requests the certificate of the RabbitMQ nodes from cert-manager and stores the CA certificate of the
+// issuer in the secret rabbitmq-tls-ca.
+func createTLS(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) ([]pulumi.Resource, error) {
+	namespace := args.Namespace.Metadata.Name().Elem()
+
+	cert, err := certmanager.NewCertificate(
+		ctx,
+		"rabbitmq-tls",
+		args.Issuer,
+		&certmanager.CertificateArgs{
+			Namespace:  namespace,
+			SecretName: tlsSecretName,
+			CommonName: pulumi.String("rabbitmq"),
+			DNSNames:   dnsNames(namespace),
+		},
+		pulumi.Parent(component),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	caSecret, err := pulumiv1.NewSecret(
+		ctx,
+		tlsCASecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(tlsCASecretName),
+				Namespace: namespace,
+			},
+			StringData: pulumi.StringMap{
+				"ca.crt": args.Issuer.CACert,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []pulumi.Resource{cert, caSecret}, nil
+}
+
+// dnsNames returns the names under which the cluster "rabbitmq" is reachable: via the client service and via the
+// headless service of the nodes.
+func dnsNames(namespace pulumi.StringOutput) pulumi.StringArray {
+	return pulumi.StringArray{
+		pulumi.String("rabbitmq"),
+		pulumi.Sprintf("rabbitmq.%s", namespace),
+		pulumi.Sprintf("rabbitmq.%s.svc", namespace),
+		pulumi.Sprintf("rabbitmq.%s.svc.cluster.local", namespace),
+		pulumi.Sprintf("*.rabbitmq-nodes.%s", namespace),
+		pulumi.Sprintf("*.rabbitmq-nodes.%s.svc", namespace),
+		pulumi.Sprintf("*.rabbitmq-nodes.%s.svc.cluster.local", namespace),
+	}
+}
@@ -0,0 +1,63 @@
+# Policy of the admin token created when Vault is bootstrapped. It allows what the deployment configures: auth methods
+# and their roles, secrets engines, policies, audit devices and restoring raft snapshots.
+#
+# This is effectively root-equivalent: whoever holds the admin token can write a policy granting everything and assign
+# it to an auth role they can log in with. Protect it like the root token. Unlike the root token, it expires unless it
+# is renewed, and it can't disable audit devices or remove raft peers without escalating first, which the audit log
+# records.
+
+path "sys/auth" {
+  capabilities = ["read"]
+}
+
+path "sys/auth/*" {
+  capabilities = ["create", "read", "update", "sudo"]
+}
+
+path "auth/kubernetes/config" {
+  capabilities = ["create", "read", "update"]
+}
+
+path "auth/kubernetes/role/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+path "auth/approle/role/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+path "sys/mounts" {
+  capabilities = ["read"]
+}
+
+path "sys/mounts/*" {
+  capabilities = ["create", "read", "update"]
+}
+
+path "sys/policies/acl" {
+  capabilities = ["list"]
+}
+
+path "sys/policies/acl/*" {
+  capabilities = ["create", "read", "update", "list"]
+}
+
+path "sys/audit" {
+  capabilities = ["read", "sudo"]
+}
+
+path "sys/audit/*" {
+  capabilities = ["create", "read", "update", "sudo"]
+}
+
+path "sys/storage/raft/snapshot" {
+  capabilities = ["read"]
+}
+
+path "sys/storage/raft/snapshot-force" {
+  capabilities = ["update", "sudo"]
+}
+
+path "sys/health" {
+  capabilities = ["read", "sudo"]
+}
@@ -0,0 +1,242 @@
+package vault
+
+import (
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/hashicorp/vault/api"
+	corev1 "k8s.io/api/core/v1"
+	"strings"
+	"time"
+)
+
+// apiPort is the port of the Vault API in the pods.
+const apiPort = 8200
+
+// connectFunc returns a Vault API client for a pod and a function that releases the connection.
+type connectFunc func(pod *corev1.Pod) (*api.Client, func(), error)
+
+// vaultNodes talks to the Vault API of the individual pods, which is necessary for the endpoints that operate on a
+// single node, like init, unseal and raft join.
+type vaultNodes struct {
+	connect connectFunc
+	// scheme is the scheme of the addresses the pods use to reach each other.
+	scheme string
+	// caCert is the PEM encoded CA certificate of the Vault listeners, empty if TLS is disabled.
+	caCert string
+}
+
+// newPortForwardNodes returns vaultNodes that reach the pods through a port-forward. If tls is true, the listeners are
+// verified with the CA certificate of the cluster.
+func newPortForwardNodes(tls bool, kc *common.KubernetesClient) (*vaultNodes, error) {
+	nodes := &vaultNodes{scheme: "http"}
+	var caCert []byte
+
+	if tls {
+		data, err := kc.GetSecret(tlsCASecretName)
+		if err != nil {
+			return nil, err
+		}
+		if len(data["ca.crt"]) == 0 {
+			return nil, fmt.Errorf("secret %s contains no CA certificate", tlsCASecretName)
+		}
+
+		nodes.scheme = "https"
+		nodes.caCert = string(data["ca.crt"])
+		// The certificates of the pods are valid for 127.0.0.1, so the forwarded port can be verified as usual.
+		caCert = data["ca.crt"]
+	}
+
+	nodes.connect = func(pod *corev1.Pod) (*api.Client, func(), error) {
+		localPort, stop, err := kc.PortForward(pod, apiPort)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		client, err := common.NewVaultClient(fmt.Sprintf("%s://127.0.0.1:%d", nodes.scheme, localPort), caCert)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+
+		return client, stop, nil
+	}
+
+	return nodes, nil
+}
+
+// listenerTLS returns whether the Vault listener of the pod uses TLS, judging by the VAULT_ADDR the Helm chart sets for
+// the vault CLI in the pod.
+func listenerTLS(pod *corev1.Pod) bool {
+	for _, container := range pod.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == "VAULT_ADDR" {
+				return strings.HasPrefix(env.Value, "https://")
+			}
+		}
+	}
+	return false
+}
+
+// connectWithToken is like connect, but the client authenticates with token.
+func (n *vaultNodes) connectWithToken(pod *corev1.Pod, token string) (*api.Client, func(), error) {
+	client, release, err := n.connect(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client.SetToken(token)
+	return client, release, nil
+}
+
+// status returns whether the pod is initialised and sealed.
+func (n *vaultNodes) status(pod *corev1.Pod) (vaultStatus, error) {
+	client, release, err := n.connect(pod)
+	if err != nil {
+		return vaultStatus{}, err
+	}
+	defer release()
+
+	health, err := client.Sys().Health()
+	if err != nil {
+		return vaultStatus{}, fmt.Errorf("status(%s): %w", pod.Name, err)
+	}
+
+	return vaultStatus{Initialized: health.Initialized, Sealed: health.Sealed}, nil
+}
+
+// statuses returns the status of every pod, keyed by pod name.
+func (n *vaultNodes) statuses(pods []corev1.Pod) (map[string]vaultStatus, error) {
+	statuses := make(map[string]vaultStatus)
+
+	for i := range pods {
+		status, err := n.status(&pods[i])
+		if err != nil {
+			return nil, err
+		}
+		statuses[pods[i].Name] = status
+	}
+
+	return statuses, nil
+}
+
+// waitUnsealed waits until the pod is unsealed, which takes a moment with auto-unseal.
+func (n *vaultNodes) waitUnsealed(pod *corev1.Pod, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		status, err := n.status(pod)
+		if err != nil {
+			return err
+		}
+		if !status.Sealed {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("pod %s is still sealed after %.0f seconds", pod.Name, timeout.Seconds())
+}
+
+// init initialises Vault on the pod with the configured key shares. With auto-unseal the shares apply to the recovery
+// keys.
+func (n *vaultNodes) init(pod *corev1.Pod, args *ClusterArgs) (InitInfo, error) {
+	client, release, err := n.connect(pod)
+	if err != nil {
+		return InitInfo{}, err
+	}
+	defer release()
+
+	resp, err := client.Sys().Init(initRequest(args))
+	if err != nil {
+		return InitInfo{}, fmt.Errorf("init(%s): %w", pod.Name, err)
+	}
+
+	return newInitInfo(resp, args), nil
+}
+
+// initRequest returns the parameters for /sys/init. The PGP keys are passed as they are, because the API expects
+// base64 encoded public keys.
+func initRequest(args *ClusterArgs) *api.InitRequest {
+	if args.TransitSeal != nil {
+		return &api.InitRequest{
+			RecoveryShares:    args.KeyShares,
+			RecoveryThreshold: args.KeyThreshold,
+			RecoveryPGPKeys:   args.PGPKeys,
+			RootTokenPGPKey:   args.RootTokenPGPKey,
+		}
+	}
+
+	return &api.InitRequest{
+		SecretShares:    args.KeyShares,
+		SecretThreshold: args.KeyThreshold,
+		PGPKeys:         args.PGPKeys,
+		RootTokenPGPKey: args.RootTokenPGPKey,
+	}
+}
+
+func newInitInfo(resp *api.InitResponse, args *ClusterArgs) InitInfo {
+	initInfo := InitInfo{
+		UnsealKeys:         resp.KeysB64,
+		RecoveryKeys:       resp.RecoveryKeysB64,
+		RootToken:          resp.RootToken,
+		Encrypted:          len(args.PGPKeys) > 0,
+		RootTokenEncrypted: args.RootTokenPGPKey != "",
+	}
+
+	if args.TransitSeal != nil {
+		initInfo.RecoveryShares = args.KeyShares
+		initInfo.RecoveryThreshold = args.KeyThreshold
+	} else {
+		initInfo.UnsealShares = args.KeyShares
+		initInfo.UnsealThreshold = args.KeyThreshold
+	}
+
+	return initInfo
+}
+
+// unseal submits unseal keys to the pod until it is unsealed or threshold keys have been submitted.
+func (n *vaultNodes) unseal(pod *corev1.Pod, unsealKeys []string, threshold int) error {
+	client, release, err := n.connect(pod)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for i, key := range unsealKeys {
+		if i >= threshold {
+			break
+		}
+
+		status, err := client.Sys().Unseal(key)
+		if err != nil {
+			return fmt.Errorf("unseal(%s): %w", pod.Name, err)
+		}
+		if !status.Sealed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unseal(%s): pod is still sealed after submitting the unseal keys", pod.Name)
+}
+
+// join adds the pod to the raft cluster of the leader.
+func (n *vaultNodes) join(pod *corev1.Pod, leaderPodName string) error {
+	client, release, err := n.connect(pod)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	resp, err := client.Sys().RaftJoin(&api.RaftJoinRequest{
+		LeaderAPIAddr: fmt.Sprintf("%s://%s.%s-internal:%d", n.scheme, leaderPodName, fullName, apiPort),
+		LeaderCACert:  n.caCert,
+	})
+	if err != nil {
+		return fmt.Errorf("join(%s, %s): %w", pod.Name, leaderPodName, err)
+	}
+	if !resp.Joined {
+		return fmt.Errorf("join(%s, %s): vault did not join the raft cluster", pod.Name, leaderPodName)
+	}
+
+	return nil
+}
@@ -0,0 +1,486 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/hashicorp/vault/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault implements the parts of the Vault API used by vaultNodes and the configuration for a single node.
+type fakeVault struct {
+	mu          sync.Mutex
+	initialized bool
+	sealed      bool
+	threshold   int
+	progress    int
+	autoUnseal  bool
+	initReq     *api.InitRequest
+	joinReq     *api.RaftJoinRequest
+	unsealKeys  []string
+	// policies, mounts, audits, auths and writes hold the written policies, the enabled secrets engines and audit
+	// devices, the types of the enabled auth methods and the bodies of other writes, keyed by policy name, mount path
+	// and API path.
+	policies map[string]string
+	mounts   map[string]*api.MountInput
+	audits   map[string]*api.EnableAuditOptions
+	auths    map[string]string
+	writes   map[string]map[string]interface{}
+	tokenReq *api.TokenCreateRequest
+	revoked  []string
+	// secretIDs are the secret IDs created for the AppRole of ORT Server.
+	secretIDs []string
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	fake := &fakeVault{
+		sealed:   true,
+		policies: make(map[string]string),
+		mounts:   make(map[string]*api.MountInput),
+		audits:   make(map[string]*api.EnableAuditOptions),
+		auths:    map[string]string{"token/": "token"},
+		writes:   make(map[string]map[string]interface{}),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resp interface{}
+	token := r.Header.Get("X-Vault-Token")
+
+	switch path := r.URL.Path; {
+	case path == "/v1/sys/health":
+		resp = api.HealthResponse{Initialized: f.initialized, Sealed: f.sealed}
+	case path == "/v1/sys/init":
+		f.initReq = &api.InitRequest{}
+		_ = json.NewDecoder(r.Body).Decode(f.initReq)
+		f.initialized = true
+		f.threshold = f.initReq.SecretThreshold
+		resp = api.InitResponse{KeysB64: []string{"key1", "key2", "key3"}, RootToken: "faketokenisfake"}
+	case path == "/v1/sys/unseal":
+		var body struct{ Key string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.unsealKeys = append(f.unsealKeys, body.Key)
+		f.progress++
+		if f.progress >= f.threshold {
+			f.sealed = false
+		}
+		resp = api.SealStatusResponse{Initialized: f.initialized, Sealed: f.sealed, T: f.threshold}
+	case path == "/v1/sys/storage/raft/join":
+		f.joinReq = &api.RaftJoinRequest{}
+		_ = json.NewDecoder(r.Body).Decode(f.joinReq)
+		f.initialized = true
+		f.sealed = !f.autoUnseal
+		resp = api.RaftJoinResponse{Joined: true}
+	case strings.HasPrefix(path, "/v1/sys/policies/acl/"):
+		var body struct{ Policy string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.policies[strings.TrimPrefix(path, "/v1/sys/policies/acl/")] = body.Policy
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case path == "/v1/sys/mounts":
+		data := make(map[string]interface{})
+		for mount, input := range f.mounts {
+			data[mount] = map[string]interface{}{"type": input.Type, "options": input.Options}
+		}
+		resp = api.Secret{Data: data}
+	case strings.HasPrefix(path, "/v1/sys/mounts/"):
+		input := &api.MountInput{}
+		_ = json.NewDecoder(r.Body).Decode(input)
+		f.mounts[strings.TrimPrefix(path, "/v1/sys/mounts/")+"/"] = input
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case path == "/v1/sys/audit":
+		data := make(map[string]interface{})
+		for device, options := range f.audits {
+			data[device] = map[string]interface{}{"type": options.Type, "options": options.Options}
+		}
+		resp = api.Secret{Data: data}
+	case strings.HasPrefix(path, "/v1/sys/audit/"):
+		options := &api.EnableAuditOptions{}
+		_ = json.NewDecoder(r.Body).Decode(options)
+		f.audits[strings.TrimPrefix(path, "/v1/sys/audit/")+"/"] = options
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case path == "/v1/sys/auth":
+		data := make(map[string]interface{})
+		for mount, authType := range f.auths {
+			data[mount] = map[string]interface{}{"type": authType}
+		}
+		resp = api.Secret{Data: data}
+	case strings.HasPrefix(path, "/v1/sys/auth/"):
+		var body api.EnableAuthOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.auths[strings.TrimPrefix(path, "/v1/sys/auth/")+"/"] = body.Type
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case path == "/v1/auth/token/create-orphan":
+		f.tokenReq = &api.TokenCreateRequest{}
+		_ = json.NewDecoder(r.Body).Decode(f.tokenReq)
+		resp = api.Secret{Auth: &api.SecretAuth{ClientToken: "fakeadmintoken"}}
+	case path == "/v1/auth/token/revoke-self":
+		f.revoked = append(f.revoked, token)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case path == "/v1/auth/approle/role/ort-server/role-id":
+		resp = api.Secret{Data: map[string]interface{}{"role_id": "fakeroleid"}}
+	case path == "/v1/auth/approle/role/ort-server/secret-id":
+		f.secretIDs = append(f.secretIDs, fmt.Sprintf("fakesecretid%d", len(f.secretIDs)+1))
+		resp = api.Secret{Data: map[string]interface{}{"secret_id": f.secretIDs[len(f.secretIDs)-1]}}
+	case path == "/v1/auth/approle/role/ort-server/secret-id/lookup":
+		var body struct {
+			SecretID string `json:"secret_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if !slices.Contains(f.secretIDs, body.SecretID) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		resp = api.Secret{Data: map[string]interface{}{"secret_id_accessor": "fakeaccessor"}}
+	case strings.HasPrefix(path, "/v1/auth/") && r.Method == http.MethodPut:
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.writes[strings.TrimPrefix(path, "/v1/")] = body
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// newFakeCluster returns pods named after the nodes of a cluster with the given replicas, a fake Vault per pod and
+// vaultNodes connected to them.
+func newFakeCluster(t *testing.T, replicas int) ([]corev1.Pod, map[string]*fakeVault, *vaultNodes) {
+	var pods []corev1.Pod
+	fakes := make(map[string]*fakeVault)
+	servers := make(map[string]*httptest.Server)
+
+	for _, name := range nodeNames(replicas) {
+		pods = append(pods, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}})
+		fakes[name], servers[name] = newFakeVault(t)
+	}
+
+	nodes := &vaultNodes{
+		scheme: "http",
+		connect: func(pod *corev1.Pod) (*api.Client, func(), error) {
+			client, err := common.NewVaultClient(servers[pod.Name].URL, nil)
+			return client, func() {}, err
+		},
+	}
+
+	return pods, fakes, nodes
+}
+
+func TestUnsealNewCluster(t *testing.T) {
+	pods, fakes, nodes := newFakeCluster(t, 3)
+	args := &ClusterArgs{KeyShares: 3, KeyThreshold: 2}
+	for _, fake := range fakes {
+		// Nodes that join the cluster get the seal configuration from the leader.
+		fake.threshold = args.KeyThreshold
+	}
+
+	statuses, err := nodes.statuses(pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findLeader(pods, statuses); ok {
+		t.Fatal("expected no leader for an uninitialised cluster")
+	}
+
+	initInfo, err := unseal(pods, statuses, args, nodes)
+	if err != nil {
+		t.Fatalf("unseal() returned an unexpected error: %v", err)
+	}
+
+	if !slices.Equal(initInfo.UnsealKeys, []string{"key1", "key2", "key3"}) {
+		t.Errorf("unexpected unseal keys: %v", initInfo.UnsealKeys)
+	}
+	if initInfo.RootToken != "faketokenisfake" {
+		t.Errorf("expected initial root token to be faketokenisfake, got %s", initInfo.RootToken)
+	}
+	if initInfo.UnsealShares != 3 || initInfo.UnsealThreshold != 2 {
+		t.Errorf("unexpected unseal shares/threshold: %d/%d", initInfo.UnsealShares, initInfo.UnsealThreshold)
+	}
+
+	leader := fakes["vault-0"]
+	if leader.initReq == nil || leader.initReq.SecretShares != 3 || leader.initReq.SecretThreshold != 2 {
+		t.Errorf("unexpected init request: %+v", leader.initReq)
+	}
+	if leader.joinReq != nil {
+		t.Error("expected the leader not to join a raft cluster")
+	}
+
+	for _, name := range []string{"vault-1", "vault-2"} {
+		fake := fakes[name]
+		if fake.initReq != nil {
+			t.Errorf("expected %s not to be initialised directly", name)
+		}
+		if fake.joinReq == nil || fake.joinReq.LeaderAPIAddr != "http://vault-0.vault-internal:8200" {
+			t.Errorf("unexpected join request for %s: %+v", name, fake.joinReq)
+		}
+	}
+
+	for name, fake := range fakes {
+		if !slices.Equal(fake.unsealKeys, []string{"key1", "key2"}) {
+			t.Errorf("expected %s to be unsealed with the first two keys, got %v", name, fake.unsealKeys)
+		}
+		if fake.sealed {
+			t.Errorf("expected %s to be unsealed", name)
+		}
+	}
+}
+
+func TestReconcilePodsAutoUnseal(t *testing.T) {
+	pods, fakes, nodes := newFakeCluster(t, 2)
+	args := &ClusterArgs{KeyShares: 5, KeyThreshold: 3, TransitSeal: &TransitSealArgs{}}
+
+	fakes["vault-1"].initialized = true
+	fakes["vault-1"].sealed = false
+	fakes["vault-0"].autoUnseal = true
+
+	statuses, err := nodes.statuses(pods)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader, ok := findLeader(pods, statuses)
+	if !ok || leader != "vault-1" {
+		t.Fatalf("expected vault-1 to be the leader, got %q", leader)
+	}
+
+	err = reconcilePods(pods, statuses, leader, nil, args, nodes)
+	if err != nil {
+		t.Fatalf("reconcilePods() returned an unexpected error: %v", err)
+	}
+
+	joinReq := fakes["vault-0"].joinReq
+	if joinReq == nil || joinReq.LeaderAPIAddr != "http://vault-1.vault-internal:8200" {
+		t.Errorf("unexpected join request: %+v", joinReq)
+	}
+	for name, fake := range fakes {
+		if len(fake.unsealKeys) != 0 {
+			t.Errorf("expected no unseal keys to be submitted to %s with auto-unseal", name)
+		}
+	}
+}
+
+func TestUnsealStillSealed(t *testing.T) {
+	pods, fakes, nodes := newFakeCluster(t, 1)
+	fakes["vault-0"].initialized = true
+	fakes["vault-0"].threshold = 3
+
+	err := nodes.unseal(&pods[0], []string{"key1", "key2"}, 3)
+	if err == nil {
+		t.Fatal("expected an error for a pod that is still sealed")
+	}
+}
+
+func TestInitRequest(t *testing.T) {
+	args := &ClusterArgs{
+		KeyShares:       2,
+		KeyThreshold:    2,
+		PGPKeys:         []string{"a2V5MQ==", "a2V5Mg=="},
+		RootTokenPGPKey: "cm9vdA==",
+	}
+
+	req := initRequest(args)
+	if req.SecretShares != 2 || req.SecretThreshold != 2 || req.RecoveryShares != 0 {
+		t.Errorf("unexpected shares: %+v", req)
+	}
+	if !slices.Equal(req.PGPKeys, args.PGPKeys) || req.RootTokenPGPKey != "cm9vdA==" {
+		t.Errorf("unexpected PGP keys: %+v", req)
+	}
+
+	args.TransitSeal = &TransitSealArgs{}
+	req = initRequest(args)
+	if req.RecoveryShares != 2 || req.RecoveryThreshold != 2 || req.SecretShares != 0 {
+		t.Errorf("unexpected shares with auto-unseal: %+v", req)
+	}
+	if !slices.Equal(req.RecoveryPGPKeys, args.PGPKeys) || len(req.PGPKeys) != 0 {
+		t.Errorf("unexpected PGP keys with auto-unseal: %+v", req)
+	}
+}
+
+// chdirRepoRoot changes to the root of the repository, which the paths of the policy files are relative to.
+func chdirRepoRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestBootstrap(t *testing.T) {
+	chdirRepoRoot(t)
+	pods, fakes, nodes := newFakeCluster(t, 1)
+	fake := fakes["vault-0"]
+	fake.initialized = true
+	fake.sealed = false
+
+	adminToken, err := bootstrap(&pods[0], "faketokenisfake", &ClusterArgs{AdminTokenPeriod: "768h"}, nodes)
+	if err != nil {
+		t.Fatalf("bootstrap() returned an unexpected error: %v", err)
+	}
+
+	if adminToken != "fakeadmintoken" {
+		t.Errorf("expected admin token fakeadmintoken, got %s", adminToken)
+	}
+	if !strings.Contains(fake.policies[adminPolicyName], "sys/policies/acl") {
+		t.Errorf("unexpected admin policy: %q", fake.policies[adminPolicyName])
+	}
+	if _, ok := fake.auths["kubernetes/"]; ok {
+		t.Error("expected the kubernetes auth method to be enabled only for snapshots")
+	}
+
+	req := fake.tokenReq
+	if req == nil || !slices.Equal(req.Policies, []string{adminPolicyName}) || req.Period != "768h" {
+		t.Errorf("unexpected token create request: %+v", req)
+	}
+	if !slices.Equal(fake.revoked, []string{"faketokenisfake"}) {
+		t.Errorf("expected the root token to be revoked, got %v", fake.revoked)
+	}
+}
+
+func TestConfigureORTServer(t *testing.T) {
+	chdirRepoRoot(t)
+	pods, fakes, nodes := newFakeCluster(t, 1)
+	fake := fakes["vault-0"]
+	args := &ClusterArgs{ORTServer: &ORTServerArgs{MountPath: "ort-server"}}
+
+	client, release, err := nodes.connectWithToken(&pods[0], "fakeadmintoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	var initInfo InitInfo
+	if err := configureORTServer(&pods[0], client, args, &initInfo); err != nil {
+		t.Fatalf("configureORTServer() returned an unexpected error: %v", err)
+	}
+
+	mount := fake.mounts["ort-server/"]
+	if mount == nil || mount.Type != "kv" || mount.Options["version"] != "2" {
+		t.Errorf("expected a KV v2 secrets engine at ort-server, got %+v", mount)
+	}
+	if fake.auths["approle/"] != "approle" {
+		t.Errorf("expected the approle auth method to be enabled, got %v", fake.auths)
+	}
+	if !strings.Contains(fake.policies[ortServerPolicyName], "ort-server/data/*") {
+		t.Errorf("unexpected ORT Server policy: %q", fake.policies[ortServerPolicyName])
+	}
+	if policies := fake.writes["auth/approle/role/ort-server"]["token_policies"]; policies != ortServerPolicyName {
+		t.Errorf("unexpected token policies of the AppRole: %v", policies)
+	}
+	if initInfo.ORTServerRoleID != "fakeroleid" || initInfo.ORTServerSecretID != "fakesecretid1" {
+		t.Errorf("unexpected AppRole credentials: %s/%s", initInfo.ORTServerRoleID, initInfo.ORTServerSecretID)
+	}
+
+	// The next deployment keeps the secret ID as long as Vault accepts it.
+	if err := configureORTServer(&pods[0], client, args, &initInfo); err != nil {
+		t.Fatal(err)
+	}
+	if initInfo.ORTServerSecretID != "fakesecretid1" {
+		t.Errorf("expected the secret ID to be kept, got %s", initInfo.ORTServerSecretID)
+	}
+
+	initInfo.ORTServerSecretID = "revoked"
+	if err := configureORTServer(&pods[0], client, args, &initInfo); err != nil {
+		t.Fatal(err)
+	}
+	if initInfo.ORTServerSecretID != "fakesecretid2" {
+		t.Errorf("expected a new secret ID to replace an unknown one, got %s", initInfo.ORTServerSecretID)
+	}
+}
+
+func TestConfigureAudit(t *testing.T) {
+	pods, fakes, nodes := newFakeCluster(t, 1)
+	fake := fakes["vault-0"]
+	// Devices that are enabled already are left alone.
+	fake.audits["file/"] = &api.EnableAuditOptions{Type: "file", Options: map[string]string{"file_path": "stdout"}}
+
+	client, release, err := nodes.connectWithToken(&pods[0], "fakeadmintoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	args := &AuditArgs{Socket: &AuditSocketArgs{Address: "fluent-bit:5170", SocketType: "tcp"}}
+	if err := configureAudit(&pods[0], client, args); err != nil {
+		t.Fatalf("configureAudit() returned an unexpected error: %v", err)
+	}
+
+	if path := fake.audits["file/"].Options["file_path"]; path != "stdout" {
+		t.Errorf("expected the enabled file audit device to be kept, got file_path %s", path)
+	}
+	socket := fake.audits["socket/"]
+	if socket == nil || socket.Type != "socket" || socket.Options["address"] != "fluent-bit:5170" {
+		t.Errorf("unexpected socket audit device: %+v", socket)
+	}
+}
+
+func TestConfigureSnapshots(t *testing.T) {
+	chdirRepoRoot(t)
+	pods, fakes, nodes := newFakeCluster(t, 1)
+	fake := fakes["vault-0"]
+
+	client, release, err := nodes.connectWithToken(&pods[0], "fakeadmintoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if err := configureSnapshots(&pods[0], client, "ort-server"); err != nil {
+		t.Fatalf("configureSnapshots() returned an unexpected error: %v", err)
+	}
+
+	if fake.auths["kubernetes/"] != "kubernetes" {
+		t.Errorf("expected the kubernetes auth method to be enabled, got %v", fake.auths)
+	}
+	if host := fake.writes["auth/kubernetes/config"]["kubernetes_host"]; host != kubernetesHost {
+		t.Errorf("unexpected kubernetes_host: %v", host)
+	}
+	if fake.policies[snapshotName] == "" {
+		t.Error("expected the snapshot policy to be written")
+	}
+
+	role := fake.writes["auth/kubernetes/role/"+snapshotName]
+	if role["bound_service_account_namespaces"] != "ort-server" || role["token_policies"] != snapshotName {
+		t.Errorf("unexpected snapshot role: %v", role)
+	}
+}
+
+func TestListenerTLS(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "vault",
+		Env:  []corev1.EnvVar{{Name: "VAULT_ADDR", Value: "https://127.0.0.1:8200"}},
+	}}}}
+	if !listenerTLS(pod) {
+		t.Error("expected a pod with an https VAULT_ADDR to use TLS")
+	}
+
+	pod.Spec.Containers[0].Env[0].Value = "http://127.0.0.1:8200"
+	if listenerTLS(pod) {
+		t.Error("expected a pod with an http VAULT_ADDR not to use TLS")
+	}
+}
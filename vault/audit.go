@@ -0,0 +1,197 @@
+package vault
+
+import (
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// auditDir is where the Helm chart mounts the audit storage volume.
+	auditDir           = "/vault/audit"
+	auditLogPath       = auditDir + "/audit.log"
+	auditConfigMapName = "vault-audit-fluent-bit"
+)
+
+// AuditArgs configures the audit devices of Vault and the shipping of the audit log.
+type AuditArgs struct {
+	// StorageSize is the size of the volume the file audit device writes to, e.g. "10Gi".
+	StorageSize string `json:"storageSize"`
+	// RotateSizeMB is the size in MiB at which the audit log is rotated. Vault blocks all requests once it can't write
+	// the audit log, so RotateFiles + 2 files of this size have to fit into StorageSize.
+	RotateSizeMB int `json:"rotateSizeMB"`
+	// RotateFiles is the number of rotated audit logs kept next to the current one.
+	RotateFiles int `json:"rotateFiles"`
+	// Socket enables a socket audit device if not nil.
+	Socket *AuditSocketArgs `json:"socket"`
+	// Sink deploys a Fluent Bit sidecar forwarding the audit log if not nil.
+	Sink *AuditSinkArgs `json:"sink"`
+	// FluentBitImage is the image of the sidecar.
+	FluentBitImage string `json:"fluentBitImage"`
+}
+
+// AuditSocketArgs configures a socket audit device, e.g. for sending the audit log to a SIEM directly.
+type AuditSocketArgs struct {
+	// Address is the host and port of the receiver, e.g. "logstash:5000".
+	Address string `json:"address"`
+	// SocketType is "tcp" or "udp".
+	SocketType string `json:"socketType"`
+}
+
+// AuditSinkArgs is a Fluent Bit output, see https://docs.fluentbit.io/manual/pipeline/outputs.
+type AuditSinkArgs struct {
+	// Name is the name of the output plugin, e.g. "es", "loki" or "s3".
+	Name string `json:"name"`
+	// Options are the parameters of the output plugin, e.g. {"Host": "loki", "Port": "3100"}.
+	Options map[string]string `json:"options"`
+}
+
+// auditServerValues returns the Helm values for the audit storage volume, the sidecar rotating the audit log and, if a
+// sink is configured, the Fluent Bit sidecar.
+func auditServerValues(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+) (pulumi.Map, []pulumi.Resource, error) {
+	audit := args.Audit
+	auditMount := pulumi.Map{
+		"name":      pulumi.String("audit"),
+		"mountPath": pulumi.String(auditDir),
+	}
+
+	// The sidecar has to see the Vault process to send it SIGHUP, which makes Vault reopen the audit log.
+	values := pulumi.Map{
+		"auditStorage": pulumi.Map{
+			"enabled":   pulumi.Bool(true),
+			"size":      pulumi.String(audit.StorageSize),
+			"mountPath": pulumi.String(auditDir),
+		},
+		"shareProcessNamespace": pulumi.Bool(true),
+	}
+	containers := pulumi.MapArray{
+		pulumi.Map{
+			"name":         pulumi.String("audit-rotate"),
+			"image":        pulumi.String("hashicorp/vault:" + args.ImageTag),
+			"command":      pulumi.ToStringArray([]string{"/bin/sh", "-c", auditRotateScript(audit)}),
+			"volumeMounts": pulumi.MapArray{auditMount},
+		},
+	}
+	values["extraContainers"] = containers
+
+	if audit.Sink == nil {
+		return values, nil, nil
+	}
+
+	config, err := renderTemplate("./vault/fluent-bit.conf.tmpl", map[string]interface{}{
+		"Path": auditLogPath,
+		"Sink": audit.Sink,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configMap, err := pulumiv1.NewConfigMap(
+		ctx,
+		auditConfigMapName,
+		&pulumiv1.ConfigMapArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(auditConfigMapName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			Data: pulumi.StringMap{
+				"fluent-bit.conf": pulumi.String(config),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values["volumes"] = pulumi.MapArray{
+		pulumi.Map{
+			"name": pulumi.String("fluent-bit-config"),
+			"configMap": pulumi.Map{
+				"name": pulumi.String(auditConfigMapName),
+			},
+		},
+	}
+	values["extraContainers"] = append(containers,
+		pulumi.Map{
+			"name":  pulumi.String("fluent-bit"),
+			"image": pulumi.String(audit.FluentBitImage),
+			"args": pulumi.StringArray{
+				pulumi.String("-c"),
+				pulumi.String("/fluent-bit/config/fluent-bit.conf"),
+			},
+			"volumeMounts": pulumi.MapArray{
+				auditMount,
+				pulumi.Map{
+					"name":      pulumi.String("fluent-bit-config"),
+					"mountPath": pulumi.String("/fluent-bit/config"),
+					"readOnly":  pulumi.Bool(true),
+				},
+			},
+		},
+	)
+
+	return values, []pulumi.Resource{configMap}, nil
+}
+
+// auditRotateScript returns the script of the sidecar rotating the audit log. The file audit device neither rotates
+// nor truncates its file, so it would fill up the audit storage.
+func auditRotateScript(args *AuditArgs) string {
+	return fmt.Sprintf(`log='%s'
+while true; do
+  if [ -f "$log" ] && [ "$(stat -c %%s "$log")" -ge %d ]; then
+    i=%d
+    rm -f "$log.$i"
+    while [ "$i" -gt 1 ]; do
+      [ ! -f "$log.$((i - 1))" ] || mv "$log.$((i - 1))" "$log.$i"
+      i=$((i - 1))
+    done
+    mv "$log" "$log.1"
+    pkill -HUP -x vault
+  fi
+  sleep 30
+done`,
+		auditLogPath,
+		args.RotateSizeMB<<20,
+		args.RotateFiles,
+	)
+}
+
+// configureAudit enables the file audit device and, if configured, the socket audit device. Devices that are enabled
+// already are left alone, so changing their options requires disabling them with "vault audit disable" first.
+func configureAudit(pod *corev1.Pod, client *api.Client, args *AuditArgs) error {
+	enabled, err := client.Sys().ListAudit()
+	if err != nil {
+		return fmt.Errorf("configureAudit(%s): %w", pod.Name, err)
+	}
+
+	devices := map[string]map[string]string{
+		"file": {"file_path": auditLogPath},
+	}
+	if args.Socket != nil {
+		devices["socket"] = map[string]string{
+			"address":     args.Socket.Address,
+			"socket_type": args.Socket.SocketType,
+		}
+	}
+
+	for device, options := range devices {
+		if _, ok := enabled[device+"/"]; ok {
+			continue
+		}
+
+		err := client.Sys().EnableAuditWithOptions(device, &api.EnableAuditOptions{Type: device, Options: options})
+		if err != nil {
+			return fmt.Errorf("configureAudit(%s): %w", pod.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderFluentBitConfig(t *testing.T) {
+	config, err := renderTemplate("fluent-bit.conf.tmpl", map[string]interface{}{
+		"Path": auditLogPath,
+		"Sink": &AuditSinkArgs{
+			Name: "loki",
+			Options: map[string]string{
+				"Host": "loki.monitoring.svc",
+				"Port": "3100",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("renderTemplate() returned an unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"Path   /vault/audit/audit.log",
+		"Name  loki",
+		"Match vault.audit",
+		"    Host loki.monitoring.svc\n    Port 3100",
+	}
+	for _, e := range expected {
+		if !strings.Contains(config, e) {
+			t.Fatalf("expected Fluent Bit config to contain %q, got:\n%s", e, config)
+		}
+	}
+}
+
+func TestAuditRotateScript(t *testing.T) {
+	script := auditRotateScript(&AuditArgs{RotateSizeMB: 100, RotateFiles: 3})
+
+	expected := []string{
+		"log='/vault/audit/audit.log'",
+		`[ "$(stat -c %s "$log")" -ge 104857600 ]`,
+		"i=3",
+		"pkill -HUP -x vault",
+	}
+	for _, e := range expected {
+		if !strings.Contains(script, e) {
+			t.Fatalf("expected rotation script to contain %q, got:\n%s", e, script)
+		}
+	}
+}
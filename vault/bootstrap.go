@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	corev1 "k8s.io/api/core/v1"
+	"os"
+	"time"
+)
+
+const (
+	adminPolicyName = "admin"
+	// kubernetesHost is the address of the Kubernetes API used by the Kubernetes auth method to verify tokens.
+	kubernetesHost = "https://kubernetes.default.svc:443"
+)
+
+// bootstrap configures a freshly initialised Vault with the root token, creates an admin token and revokes the root
+// token, so that no token with unlimited privileges is kept in the stack state. It returns the admin token.
+//
+// The admin token is an orphan periodic token with the policy in admin-policy.hcl. It is renewed on every deployment
+// and expires if it is not renewed within args.AdminTokenPeriod.
+//
+// If a root token is needed again, e.g. because the admin token expired, a new one can be generated with a quorum of
+// unseal keys (or recovery keys with auto-unseal):
+//
+//	vault operator generate-root -init                  # prints the nonce and the one-time password (OTP)
+//	vault operator generate-root -nonce=<nonce> <key>   # run by the key holders until the threshold is reached
+//	vault operator generate-root -decode=<encoded token> -otp=<OTP>
+//
+// The generated root token should be revoked with "vault token revoke -self" once it is no longer needed.
+func bootstrap(pod *corev1.Pod, rootToken string, args *ClusterArgs, nodes *vaultNodes) (string, error) {
+	if err := nodes.waitUnsealed(pod, time.Minute); err != nil {
+		return "", err
+	}
+
+	client, release, err := nodes.connectWithToken(pod, rootToken)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	if err := writeAdminPolicy(pod, client); err != nil {
+		return "", err
+	}
+
+	secret, err := client.Auth().Token().CreateOrphan(&api.TokenCreateRequest{
+		Policies:    []string{adminPolicyName},
+		Period:      args.AdminTokenPeriod,
+		DisplayName: "admin",
+	})
+	if err != nil {
+		return "", fmt.Errorf("bootstrap(%s): %w", pod.Name, err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", fmt.Errorf("bootstrap(%s): vault returned an empty admin token", pod.Name)
+	}
+
+	if err := client.Auth().Token().RevokeSelf(""); err != nil {
+		return "", fmt.Errorf("bootstrap(%s): failed to revoke the root token: %w", pod.Name, err)
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+// writeAdminPolicy writes the policy in admin-policy.hcl. The admin token itself is allowed to do so, which keeps the
+// policy up to date on clusters that were bootstrapped by an earlier version.
+func writeAdminPolicy(pod *corev1.Pod, client *api.Client) error {
+	policy, err := os.ReadFile("./vault/admin-policy.hcl")
+	if err != nil {
+		return err
+	}
+
+	if err := client.Sys().PutPolicy(adminPolicyName, string(policy)); err != nil {
+		return fmt.Errorf("writeAdminPolicy(%s): %w", pod.Name, err)
+	}
+
+	return nil
+}
+
+// renewAdminToken extends the lifetime of the admin token the client authenticates with by another period. Failures
+// are only logged, so that a revoked or expired admin token does not block deployments.
+func renewAdminToken(ctx *pulumi.Context, client *api.Client) {
+	if _, err := client.Auth().Token().RenewSelf(0); err != nil {
+		msg := fmt.Sprintf("Failed to renew the Vault admin token, it might have expired: %v", err)
+		_ = ctx.Log.Warn(msg, nil)
+	}
+}
+
+// enableAuthMethods enables the given auth methods at their default path unless they are enabled already.
+func enableAuthMethods(pod *corev1.Pod, client *api.Client, methods ...string) error {
+	enabled, err := client.Sys().ListAuth()
+	if err != nil {
+		return fmt.Errorf("enableAuthMethods(%s): %w", pod.Name, err)
+	}
+
+	for _, method := range methods {
+		if _, ok := enabled[method+"/"]; ok {
+			continue
+		}
+
+		if err := client.Sys().EnableAuthWithOptions(method, &api.EnableAuthOptions{Type: method}); err != nil {
+			return fmt.Errorf("enableAuthMethods(%s): %w", pod.Name, err)
+		}
+
+		if method == "kubernetes" {
+			_, err := client.Logical().Write("auth/kubernetes/config", map[string]interface{}{
+				"kubernetes_host": kubernetesHost,
+			})
+			if err != nil {
+				return fmt.Errorf("enableAuthMethods(%s): %w", pod.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package vault
+
+import (
+	"encoding/base64"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"time"
+)
+
+// LoadClusterArgs reads the "vault:*" keys from the stack configuration. Auto-unseal is enabled by setting
+// "vault:transitSeal" to an object with the fields of TransitSealArgs, or to {"devMode": true} to use a dev mode Vault
+// as transit provider. The token for an external transit provider is read from the secret "vault:transitSealToken".
+// The unseal controller is enabled by setting "vault:unsealController" to an object with the fields of
+// UnsealControllerArgs. It is only needed without a transit seal and cannot be combined with it.
+// Audit devices are enabled by setting "vault:audit" to an object with the fields of AuditArgs. Enabling or disabling
+// them on an existing cluster recreates the Vault StatefulSet, because its volume claims change, and replaces the pods.
+// Snapshots are saved to an S3 compatible bucket if "vault:snapshots" is set to an object with the fields of
+// SnapshotArgs. The credentials are read from the secrets "vault:snapshotsAccessKey" and "vault:snapshotsSecretKey".
+// The secrets engine and AppRole for ORT Server are configured unless "vault:ortServerEnabled" is false. The path of
+// the secrets engine is set with "vault:ortServerMountPath". ORT Server logs in with an AppRole rather than the
+// Kubernetes auth method, because its Vault secrets provider only supports AppRole credentials.
+// TLS is enabled unless "vault:tlsDisable" is true. The node certificates are signed by a self-signed CA, or by the CA
+// given with "vault:tlsCACert" and the secret "vault:tlsCAKey" (both PEM encoded). The caller sets TLSArgs.Issuer to
+// request them from cert-manager instead. Enabling TLS on an existing cluster and renewing the node certificates
+// replace all Vault pods at once during the deployment, so Vault is unavailable until they are unsealed again.
+// Certificates renewed by cert-manager are reloaded by a sidecar instead.
+// The key shares created on initialisation are configured with "vault:keyShares" and "vault:keyThreshold". To encrypt
+// them, "vault:pgpKeys" is set to a list of base64 encoded PGP public keys (e.g. "gpg --export <id> | base64"), one per
+// share. "vault:rootTokenPGPKey" does the same for the initial root token.
+func LoadClusterArgs(ctx *pulumi.Context, namespace *pulumiv1.Namespace) (*ClusterArgs, error) {
+	cfg := common.NewConfig(ctx, "vault")
+
+	args := &ClusterArgs{
+		Namespace:    namespace,
+		ChartVersion: cfg.String("chartVersion", "0.27.0"),
+		ImageTag:     cfg.String("imageTag", "1.16.2"),
+		Replicas:     cfg.Int("replicas", 3),
+		ClusterName:  cfg.String("clusterName", "vault-integrated-storage"),
+	}
+
+	cfg.NotEmpty("chartVersion", args.ChartVersion)
+	cfg.NotEmpty("imageTag", args.ImageTag)
+	cfg.NotEmpty("clusterName", args.ClusterName)
+	cfg.Positive("replicas", args.Replicas)
+	if args.Replicas%2 == 0 {
+		cfg.Errorf("replicas", "must be an odd number to maintain a raft quorum, got %d", args.Replicas)
+	}
+
+	args.KeyShares = cfg.Int("keyShares", 5)
+	args.KeyThreshold = cfg.Int("keyThreshold", 3)
+	cfg.Positive("keyShares", args.KeyShares)
+	if args.KeyShares > 255 {
+		cfg.Errorf("keyShares", "must not be greater than 255, got %d", args.KeyShares)
+	}
+	cfg.Positive("keyThreshold", args.KeyThreshold)
+	if args.KeyThreshold > args.KeyShares {
+		cfg.Errorf("keyThreshold", "must not be greater than keyShares (%d), got %d", args.KeyShares, args.KeyThreshold)
+	}
+	if args.KeyShares > 1 && args.KeyThreshold < 2 {
+		cfg.Errorf("keyThreshold", "must be at least 2 when keyShares is greater than 1")
+	}
+
+	cfg.Object("pgpKeys", &args.PGPKeys)
+	if len(args.PGPKeys) > 0 && len(args.PGPKeys) != args.KeyShares {
+		cfg.Errorf("pgpKeys", "must contain one key per share (%d), got %d", args.KeyShares, len(args.PGPKeys))
+	}
+	for i, key := range args.PGPKeys {
+		if _, err := base64.StdEncoding.DecodeString(key); err != nil {
+			cfg.Errorf("pgpKeys", "key %d is not base64 encoded: %v", i+1, err)
+		}
+	}
+
+	args.RootTokenPGPKey = cfg.String("rootTokenPGPKey", "")
+	if args.RootTokenPGPKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(args.RootTokenPGPKey); err != nil {
+			cfg.Errorf("rootTokenPGPKey", "is not base64 encoded: %v", err)
+		}
+	}
+
+	args.AdminTokenPeriod = cfg.String("adminTokenPeriod", "768h")
+	if period, err := time.ParseDuration(args.AdminTokenPeriod); err != nil || period <= 0 {
+		cfg.Errorf("adminTokenPeriod", "must be a positive duration like \"768h\", got %q", args.AdminTokenPeriod)
+	}
+
+	var transit *TransitSealArgs
+	cfg.Object("transitSeal", &transit)
+	if transit != nil {
+		if transit.MountPath == "" {
+			transit.MountPath = "transit"
+		}
+		if transit.KeyName == "" {
+			transit.KeyName = "autounseal"
+		}
+		if transit.DevMode && transit.Address != "" {
+			cfg.Errorf("transitSeal", "must not set both address and devMode")
+		}
+		if !transit.DevMode && transit.Address == "" {
+			cfg.Errorf("transitSeal", "must set address, or devMode to use a Vault in dev mode that is only meant for testing")
+		}
+		if transit.Address != "" {
+			transit.Token = cfg.Secret("transitSealToken")
+			if transit.Token == nil {
+				cfg.Errorf("transitSealToken", "must be set when transitSeal.address is set")
+			}
+		}
+		args.TransitSeal = transit
+	}
+
+	if !cfg.Bool("tlsDisable", false) {
+		args.TLS = &TLSArgs{
+			CACert:        cfg.String("tlsCACert", ""),
+			ValidityHours: cfg.Int("tlsValidityHours", 8760),
+		}
+		cfg.Positive("tlsValidityHours", args.TLS.ValidityHours)
+		if args.TLS.CACert != "" {
+			args.TLS.CAKey = cfg.Secret("tlsCAKey")
+			if args.TLS.CAKey == nil {
+				cfg.Errorf("tlsCAKey", "must be set when tlsCACert is set")
+			}
+		}
+	}
+
+	if cfg.Bool("ortServerEnabled", true) {
+		args.ORTServer = &ORTServerArgs{
+			MountPath: cfg.String("ortServerMountPath", "ort-server"),
+		}
+		cfg.NotEmpty("ortServerMountPath", args.ORTServer.MountPath)
+	}
+
+	cfg.Object("audit", &args.Audit)
+	if audit := args.Audit; audit != nil {
+		if audit.StorageSize == "" {
+			audit.StorageSize = "10Gi"
+		}
+		if audit.FluentBitImage == "" {
+			audit.FluentBitImage = "fluent/fluent-bit:3.0"
+		}
+
+		if audit.RotateSizeMB == 0 {
+			audit.RotateSizeMB = 500
+		}
+		if audit.RotateFiles == 0 {
+			audit.RotateFiles = 10
+		}
+
+		cfg.Quantity("audit.storageSize", audit.StorageSize)
+		cfg.Positive("audit.rotateSizeMB", audit.RotateSizeMB)
+		cfg.Positive("audit.rotateFiles", audit.RotateFiles)
+		if size, err := resource.ParseQuantity(audit.StorageSize); err == nil {
+			// The current log grows beyond the rotation size until the sidecar checks it.
+			required := int64(audit.RotateFiles+2) * int64(audit.RotateSizeMB) << 20
+			if required > size.Value() {
+				cfg.Errorf(
+					"audit.storageSize",
+					"must hold rotateFiles + 2 audit logs of %d MiB, got %s",
+					audit.RotateSizeMB,
+					audit.StorageSize,
+				)
+			}
+		}
+		if audit.Socket != nil {
+			if audit.Socket.SocketType == "" {
+				audit.Socket.SocketType = "tcp"
+			}
+			cfg.NotEmpty("audit.socket.address", audit.Socket.Address)
+			cfg.OneOf("audit.socket.socketType", audit.Socket.SocketType, "tcp", "udp")
+		}
+		if audit.Sink != nil {
+			cfg.NotEmpty("audit.sink.name", audit.Sink.Name)
+		}
+	}
+
+	cfg.Object("snapshots", &args.Snapshots)
+	if snapshots := args.Snapshots; snapshots != nil {
+		if snapshots.Schedule == "" {
+			snapshots.Schedule = "0 2 * * *"
+		}
+		if snapshots.Prefix == "" {
+			snapshots.Prefix = "vault"
+		}
+		if snapshots.RetentionDays == 0 {
+			snapshots.RetentionDays = 30
+		}
+		if snapshots.Image == "" {
+			snapshots.Image = "minio/mc:RELEASE.2024-05-09T17-04-24Z"
+		}
+
+		cfg.NotEmpty("snapshots.endpoint", snapshots.Endpoint)
+		cfg.NotEmpty("snapshots.bucket", snapshots.Bucket)
+		cfg.Positive("snapshots.retentionDays", snapshots.RetentionDays)
+
+		snapshots.AccessKey = cfg.Secret("snapshotsAccessKey")
+		snapshots.SecretKey = cfg.Secret("snapshotsSecretKey")
+		if snapshots.AccessKey == nil || snapshots.SecretKey == nil {
+			cfg.Errorf("snapshots", "requires the secrets vault:snapshotsAccessKey and vault:snapshotsSecretKey")
+		}
+	}
+
+	cfg.Object("unsealController", &args.UnsealController)
+	if args.UnsealController != nil {
+		cfg.NotEmpty("unsealController.image", args.UnsealController.Image)
+		if args.UnsealController.ResyncInterval == "" {
+			args.UnsealController.ResyncInterval = "30s"
+		}
+		if args.TransitSeal != nil {
+			cfg.Errorf("unsealController", "cannot be used with vault:transitSeal, the pods unseal themselves")
+		}
+		if len(args.PGPKeys) > 0 {
+			cfg.Errorf("unsealController", "cannot be used with PGP encrypted unseal keys")
+		}
+	}
+
+	return args, cfg.Err()
+}
@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// nodeConfigData holds the values substituted into node-config.hcl.tmpl.
+type nodeConfigData struct {
+	ClusterName string
+	// Nodes are the names of the Vault pods, which are all listed as raft leader candidates.
+	Nodes []string
+	// InternalService is the headless service used to address the individual pods.
+	InternalService string
+	Transit         *TransitSealArgs
+	// TLS enables TLS for the listener and raft cluster traffic if not nil.
+	TLS *tlsFiles
+}
+
+// Scheme returns the scheme of the Vault API.
+func (d nodeConfigData) Scheme() string {
+	if d.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func newNodeConfigData(args *ClusterArgs) nodeConfigData {
+	return nodeConfigData{
+		ClusterName:     args.ClusterName,
+		Nodes:           nodeNames(args.Replicas),
+		InternalService: fullName + "-internal",
+	}
+}
+
+// nodeNames returns the names of the pods of the Vault StatefulSet with the given number of replicas.
+func nodeNames(replicas int) []string {
+	names := make([]string, replicas)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", fullName, i)
+	}
+	return names
+}
+
+func renderNodeConfig(path string, data nodeConfigData) (string, error) {
+	return renderTemplate(path, data)
+}
+
+func renderTemplate(path string, data interface{}) (string, error) {
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	err = tmpl.Execute(&result, data)
+	return result.String(), err
+}
@@ -0,0 +1,161 @@
+package vault
+
+import (
+	"github.com/haikoschol/ort-server-pulumi-go/certmanager"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+	"testing"
+)
+
+func TestRenderNodeConfigWithoutSeal(t *testing.T) {
+	config, err := renderNodeConfig("node-config.hcl.tmpl", nodeConfigData{})
+	if err != nil {
+		t.Fatalf("renderNodeConfig() returned an unexpected error: %v", err)
+	}
+
+	if strings.Contains(config, "seal ") {
+		t.Fatalf("expected no seal stanza, got:\n%s", config)
+	}
+}
+
+func TestRenderNodeConfigWithTransitSeal(t *testing.T) {
+	config, err := renderNodeConfig("node-config.hcl.tmpl", nodeConfigData{
+		Transit: &TransitSealArgs{
+			Address:   "http://vault-transit:8200",
+			MountPath: "transit",
+			KeyName:   "autounseal",
+		},
+	})
+	if err != nil {
+		t.Fatalf("renderNodeConfig() returned an unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`seal "transit" {`,
+		`address = "http://vault-transit:8200"`,
+		`mount_path = "transit/"`,
+		`key_name = "autounseal"`,
+		`tls_skip_verify = "false"`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(config, e) {
+			t.Fatalf("expected node config to contain %s, got:\n%s", e, config)
+		}
+	}
+
+	if strings.Contains(config, "tls_ca_cert") {
+		t.Fatalf("expected no CA certificate for a transit Vault accessed via HTTP, got:\n%s", config)
+	}
+}
+
+func TestRenderNodeConfigWithTransitSealCA(t *testing.T) {
+	for _, tc := range []struct {
+		transit  TransitSealArgs
+		expected string
+	}{
+		{TransitSealArgs{Address: "https://vault.example.com"}, `tls_ca_cert = "/etc/ssl/certs/ca-certificates.crt"`},
+		{
+			TransitSealArgs{Address: "https://vault.example.com", TLSCACert: "-----BEGIN CERTIFICATE-----"},
+			`tls_ca_cert = "/vault/userconfig/vault-transit-ca/ca.crt"`,
+		},
+	} {
+		config, err := renderNodeConfig("node-config.hcl.tmpl", nodeConfigData{Transit: &tc.transit})
+		if err != nil {
+			t.Fatalf("renderNodeConfig() returned an unexpected error: %v", err)
+		}
+
+		if !strings.Contains(config, tc.expected) {
+			t.Fatalf("expected node config to contain %s, got:\n%s", tc.expected, config)
+		}
+	}
+}
+
+func TestRenderNodeConfigWithTLS(t *testing.T) {
+	data := newNodeConfigData(&ClusterArgs{ClusterName: "vault-integrated-storage", Replicas: 3})
+	data.TLS = newTLSFiles(&TLSArgs{})
+
+	config, err := renderNodeConfig("node-config.hcl.tmpl", data)
+	if err != nil {
+		t.Fatalf("renderNodeConfig() returned an unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`tls_disable = false`,
+		`tls_cert_file = "/vault/userconfig/tls-server/HOSTNAME.crt"`,
+		`tls_key_file = "/vault/userconfig/tls-server/HOSTNAME.key"`,
+		`leader_api_addr = "https://vault-0.vault-internal:8200"`,
+		`leader_ca_cert_file = "/vault/userconfig/tls-ca/ca.crt"`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(config, e) {
+			t.Fatalf("expected node config to contain %s, got:\n%s", e, config)
+		}
+	}
+
+	if strings.Contains(config, "http://") {
+		t.Fatalf("expected no plain HTTP addresses, got:\n%s", config)
+	}
+}
+
+func TestRenderNodeConfigWithIssuedCertificate(t *testing.T) {
+	data := newNodeConfigData(&ClusterArgs{ClusterName: "vault-integrated-storage", Replicas: 3})
+	data.TLS = newTLSFiles(&TLSArgs{Issuer: &certmanager.Issuer{}})
+
+	config, err := renderNodeConfig("node-config.hcl.tmpl", data)
+	if err != nil {
+		t.Fatalf("renderNodeConfig() returned an unexpected error: %v", err)
+	}
+
+	expected := []string{
+		`tls_cert_file = "/vault/userconfig/tls-server-issued/tls.crt"`,
+		`tls_key_file = "/vault/userconfig/tls-server-issued/tls.key"`,
+		`leader_ca_cert_file = "/vault/userconfig/tls-ca/ca.crt"`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(config, e) {
+			t.Fatalf("expected node config to contain %s, got:\n%s", e, config)
+		}
+	}
+}
+
+func TestTLSReloadContainer(t *testing.T) {
+	container := tlsReloadContainer(&ClusterArgs{ImageTag: "1.16.2", TLS: &TLSArgs{Issuer: &certmanager.Issuer{}}})
+
+	script := container["command"].(pulumi.StringArray)[2].(pulumi.String)
+	if !strings.Contains(string(script), "cert='/vault/userconfig/tls-server-issued/tls.crt'") {
+		t.Fatalf("expected the sidecar to watch the issued certificate, got:\n%s", script)
+	}
+
+	mount := container["volumeMounts"].(pulumi.MapArray)[0].(pulumi.Map)
+	if mount["mountPath"] != pulumi.String("/vault/userconfig/tls-server-issued") {
+		t.Fatalf("expected the issued certificate to be mounted, got %v", mount["mountPath"])
+	}
+}
+
+func TestRenderNodeConfigRetryJoin(t *testing.T) {
+	data := newNodeConfigData(&ClusterArgs{ClusterName: "ort-server-vault", Replicas: 5})
+
+	config, err := renderNodeConfig("node-config.hcl.tmpl", data)
+	if err != nil {
+		t.Fatalf("renderNodeConfig() returned an unexpected error: %v", err)
+	}
+
+	if count := strings.Count(config, "retry_join {"); count != 5 {
+		t.Fatalf("expected 5 retry_join stanzas, got %d:\n%s", count, config)
+	}
+
+	expected := []string{
+		`cluster_name = "ort-server-vault"`,
+		`leader_api_addr = "http://vault-0.vault-internal:8200"`,
+		`leader_api_addr = "http://vault-4.vault-internal:8200"`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(config, e) {
+			t.Fatalf("expected node config to contain %s, got:\n%s", e, config)
+		}
+	}
+
+	if strings.Contains(config, "vault-5") || strings.Contains(config, "leader_ca_cert_file") {
+		t.Fatalf("unexpected retry_join content:\n%s", config)
+	}
+}
@@ -0,0 +1,136 @@
+package vault
+
+import (
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ortServerPolicyName = "ort-server"
+	ortServerRoleName   = "ort-server"
+	// ortServerSecretName is the secret with the AppRole credentials of ORT Server, created from the outputs of the
+	// unsealer.
+	ortServerSecretName = "ort-server-vault"
+)
+
+// ORTServerArgs configures the secrets engine, policy and auth role used by ORT Server.
+type ORTServerArgs struct {
+	// MountPath is the path of the KV v2 secrets engine holding the ORT Server secrets.
+	MountPath string
+}
+
+// configureORTServer enables the KV v2 secrets engine for ORT Server, writes its policy and creates an AppRole for it.
+// It runs on every deployment, so changes to ORTServerArgs are applied. The AppRole credentials are stored in initInfo.
+//
+// ORT Server's Vault secrets provider only supports logging in with an AppRole role ID and secret ID, so the service
+// accounts of the core and the orchestrator cannot log in with the Kubernetes auth method instead.
+func configureORTServer(pod *corev1.Pod, client *api.Client, args *ClusterArgs, initInfo *InitInfo) error {
+	ortServer := args.ORTServer
+
+	policy, err := renderTemplate("./vault/ort-server-policy.hcl.tmpl", ortServer)
+	if err != nil {
+		return err
+	}
+
+	mounts, err := client.Sys().ListMounts()
+	if err != nil {
+		return fmt.Errorf("configureORTServer(%s): %w", pod.Name, err)
+	}
+
+	if _, ok := mounts[ortServer.MountPath+"/"]; !ok {
+		err := client.Sys().Mount(ortServer.MountPath, &api.MountInput{
+			Type:    "kv",
+			Options: map[string]string{"version": "2"},
+		})
+		if err != nil {
+			return fmt.Errorf("configureORTServer(%s): %w", pod.Name, err)
+		}
+	}
+
+	if err := enableAuthMethods(pod, client, "approle"); err != nil {
+		return err
+	}
+
+	if err := client.Sys().PutPolicy(ortServerPolicyName, policy); err != nil {
+		return fmt.Errorf("configureORTServer(%s): %w", pod.Name, err)
+	}
+
+	_, err = client.Logical().Write("auth/approle/role/"+ortServerRoleName, map[string]interface{}{
+		"token_policies": ortServerPolicyName,
+		"token_ttl":      "1h",
+		"token_max_ttl":  "4h",
+		"secret_id_ttl":  0,
+	})
+	if err != nil {
+		return fmt.Errorf("configureORTServer(%s): %w", pod.Name, err)
+	}
+
+	return ensureAppRoleCredentials(pod, client, initInfo)
+}
+
+// ensureAppRoleCredentials stores the role ID and a secret ID of the ORT Server AppRole in initInfo. The secret ID of
+// the previous deployment is kept as long as Vault still accepts it.
+func ensureAppRoleCredentials(pod *corev1.Pod, client *api.Client, initInfo *InitInfo) error {
+	rolePath := "auth/approle/role/" + ortServerRoleName
+
+	secret, err := client.Logical().Read(rolePath + "/role-id")
+	if err != nil {
+		return fmt.Errorf("ensureAppRoleCredentials(%s): %w", pod.Name, err)
+	}
+	roleID, _ := secretData(secret)["role_id"].(string)
+	if roleID == "" {
+		return fmt.Errorf("ensureAppRoleCredentials(%s): vault returned an empty role ID", pod.Name)
+	}
+
+	if initInfo.ORTServerRoleID == roleID && initInfo.ORTServerSecretID != "" {
+		// Vault answers without data if the secret ID does not exist (anymore).
+		secret, err := client.Logical().Write(rolePath+"/secret-id/lookup", map[string]interface{}{
+			"secret_id": initInfo.ORTServerSecretID,
+		})
+		if err == nil && secretData(secret)["secret_id_accessor"] != nil {
+			return nil
+		}
+	}
+
+	secret, err = client.Logical().Write(rolePath+"/secret-id", nil)
+	if err != nil {
+		return fmt.Errorf("ensureAppRoleCredentials(%s): %w", pod.Name, err)
+	}
+	secretID, _ := secretData(secret)["secret_id"].(string)
+	if secretID == "" {
+		return fmt.Errorf("ensureAppRoleCredentials(%s): vault returned an empty secret ID", pod.Name)
+	}
+
+	initInfo.ORTServerRoleID = roleID
+	initInfo.ORTServerSecretID = secretID
+	return nil
+}
+
+// secretData returns the data of a response, which is nil for responses without a body.
+func secretData(secret *api.Secret) map[string]interface{} {
+	if secret == nil {
+		return nil
+	}
+	return secret.Data
+}
+
+// createORTServerSecret stores the AppRole credentials exported by the unsealer in the secret ort-server-vault, with
+// the keys "role-id" and "secret-id".
+func createORTServerSecret(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) (*pulumiv1.Secret, error) {
+	return pulumiv1.NewSecret(
+		ctx,
+		ortServerSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(ortServerSecretName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			StringData: component.unsealer.ortServerCredentialsOutput(),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"slices"
+	"time"
+)
+
+// revisionLabel is the label of a StatefulSet pod with the revision of the pod template it was created from.
+const revisionLabel = "controller-revision-hash"
+
+// rollOutdatedPods replaces the pods that were created from an older revision of the StatefulSet and returns the new
+// pods. The Helm chart uses the OnDelete update strategy, so changes of the node configuration or the certificates,
+// e.g. enabling TLS, only apply to pods created afterwards. The pods are replaced together, because the unsealer can't
+// talk to pods with the old and the new listener configuration at once. Vault is unavailable until they are unsealed.
+func rollOutdatedPods(pods []corev1.Pod, timeout time.Duration, kc *common.KubernetesClient) ([]corev1.Pod, error) {
+	revision, err := waitForUpdateRevision(timeout, kc)
+	if err != nil {
+		return nil, err
+	}
+
+	outdated := outdatedPods(pods, revision)
+	if len(outdated) == 0 {
+		return pods, nil
+	}
+
+	for _, name := range outdated {
+		err := kc.Clientset().CoreV1().Pods(kc.Namespace()).Delete(context.Background(), name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("rollOutdatedPods(%s): %w", name, err)
+		}
+	}
+
+	nodes := nodeNames(len(pods))
+	deadline := time.Now().Add(timeout)
+	for {
+		found, err := kc.GetPodsWithLabel(podSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		replaced, missing := selectNodes(found, nodes)
+		if len(missing) == 0 && len(outdatedPods(replaced, revision)) == 0 {
+			return replaced, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("vault pods %s not replaced after %.0f seconds", outdated, timeout.Seconds())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// waitForUpdateRevision returns the revision of the current pod template of the Vault StatefulSet, once the
+// StatefulSet controller has processed the last change.
+func waitForUpdateRevision(timeout time.Duration, kc *common.KubernetesClient) (string, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		statefulSet, err := kc.Clientset().AppsV1().StatefulSets(kc.Namespace()).Get(
+			context.Background(),
+			fullName,
+			metav1.GetOptions{},
+		)
+		if err != nil {
+			return "", err
+		}
+
+		if revision, ok := updateRevision(statefulSet); ok {
+			return revision, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("statefulset %s not updated after %.0f seconds", fullName, timeout.Seconds())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func updateRevision(statefulSet *appsv1.StatefulSet) (string, bool) {
+	status := statefulSet.Status
+	if status.ObservedGeneration < statefulSet.Generation || status.UpdateRevision == "" {
+		return "", false
+	}
+	return status.UpdateRevision, true
+}
+
+// outdatedPods returns the names of the pods that are terminating or were not created from revision.
+func outdatedPods(pods []corev1.Pod, revision string) []string {
+	var outdated []string
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Labels[revisionLabel] != revision {
+			outdated = append(outdated, pod.Name)
+		}
+	}
+	return outdated
+}
+
+// volumeClaimsChanged returns whether the Vault StatefulSet exists and the names of its volume claim templates differ
+// from claims.
+func volumeClaimsChanged(claims []string, kc *common.KubernetesClient) (bool, error) {
+	statefulSet, err := kc.Clientset().AppsV1().StatefulSets(kc.Namespace()).Get(
+		context.Background(),
+		fullName,
+		metav1.GetOptions{},
+	)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("volumeClaimsChanged(%s): %w", fullName, err)
+	}
+
+	return !slices.Equal(claimTemplateNames(statefulSet), claims), nil
+}
+
+// recreateStatefulSet deletes the Vault StatefulSet without its pods. Kubernetes rejects changes of volume claim
+// templates, e.g. when the audit storage is enabled, so the Helm upgrade would fail. The upgrade creates the
+// StatefulSet again, which adopts the running pods, and the unsealer replaces them afterwards, see rollOutdatedPods.
+// Only the replacements get the new volumes.
+//
+// The deletion happens outside of Pulumi and does not show up in the preview, so the caller logs a warning before.
+func recreateStatefulSet(timeout time.Duration, kc *common.KubernetesClient) error {
+	statefulSets := kc.Clientset().AppsV1().StatefulSets(kc.Namespace())
+
+	orphan := metav1.DeletePropagationOrphan
+	err := statefulSets.Delete(context.Background(), fullName, metav1.DeleteOptions{PropagationPolicy: &orphan})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("recreateStatefulSet(%s): %w", fullName, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := statefulSets.Get(context.Background(), fullName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("recreateStatefulSet(%s): %w", fullName, err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("statefulset %s not deleted after %.0f seconds", fullName, timeout.Seconds())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// volumeClaims returns the sorted names of the volume claim templates the Helm chart creates for args.
+func volumeClaims(args *ClusterArgs) []string {
+	if args.Audit != nil {
+		return []string{"audit", "data"}
+	}
+	return []string{"data"}
+}
+
+// claimTemplateNames returns the sorted names of the volume claim templates of statefulSet.
+func claimTemplateNames(statefulSet *appsv1.StatefulSet) []string {
+	var names []string
+	for _, claim := range statefulSet.Spec.VolumeClaimTemplates {
+		names = append(names, claim.Name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,5 @@
+# Policy of the snapshot CronJob. It only allows taking raft snapshots.
+
+path "sys/storage/raft/snapshot" {
+  capabilities = ["read"]
+}
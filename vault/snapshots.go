@@ -0,0 +1,281 @@
+package vault
+
+import (
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/hashicorp/vault/api"
+	pulumibatchv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/batch/v1"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"os"
+)
+
+const snapshotName = "vault-snapshot"
+
+// SnapshotArgs configures a CronJob that saves raft snapshots to an S3 compatible bucket, e.g. MinIO.
+type SnapshotArgs struct {
+	// Schedule is the cron expression of the CronJob.
+	Schedule string `json:"schedule"`
+	// Endpoint is the URL of the S3 API, e.g. "https://s3.eu-central-1.amazonaws.com" or "http://minio:9000".
+	Endpoint string `json:"endpoint"`
+	Bucket   string `json:"bucket"`
+	// Prefix is the path inside the bucket the snapshots are stored below.
+	Prefix string `json:"prefix"`
+	// RetentionDays is the number of days after which snapshots are deleted from the bucket.
+	RetentionDays int `json:"retentionDays"`
+	// Image is the MinIO client image used for the upload. The default is pinned to a release, because the job relies on
+	// the flags of "mc cp" and "mc rm" to keep the retention working.
+	Image     string             `json:"image"`
+	AccessKey pulumi.StringInput `json:"-"`
+	SecretKey pulumi.StringInput `json:"-"`
+}
+
+// createSnapshotCronJob creates the CronJob saving raft snapshots. The snapshot is taken by an init container that logs
+// in with the Kubernetes auth role vault-snapshot, and uploaded by the MinIO client, which also deletes snapshots older
+// than the retention period. The role is created by configureSnapshots.
+func createSnapshotCronJob(ctx *pulumi.Context, component *Cluster, args *ClusterArgs, scheme string) error {
+	namespace := args.Namespace.Metadata.Name()
+	snapshots := args.Snapshots
+
+	serviceAccount, err := pulumiv1.NewServiceAccount(
+		ctx,
+		snapshotName,
+		&pulumiv1.ServiceAccountArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(snapshotName),
+				Namespace: namespace,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := pulumiv1.NewSecret(
+		ctx,
+		snapshotName+"-s3",
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(snapshotName + "-s3"),
+				Namespace: namespace,
+			},
+			StringData: pulumi.StringMap{
+				"access-key": snapshots.AccessKey,
+				"secret-key": snapshots.SecretKey,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	snapshotEnv := pulumiv1.EnvVarArray{
+		pulumiv1.EnvVarArgs{
+			Name:  pulumi.String("VAULT_ADDR"),
+			Value: pulumi.Sprintf("%s://%s-active.%s.svc:8200", scheme, fullName, namespace.Elem()),
+		},
+	}
+	snapshotMounts := pulumiv1.VolumeMountArray{
+		pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String("snapshots"),
+			MountPath: pulumi.String("/snapshots"),
+		},
+	}
+	volumes := pulumiv1.VolumeArray{
+		pulumiv1.VolumeArgs{
+			Name:     pulumi.String("snapshots"),
+			EmptyDir: pulumiv1.EmptyDirVolumeSourceArgs{},
+		},
+	}
+
+	if args.TLS != nil {
+		snapshotEnv = append(snapshotEnv, pulumiv1.EnvVarArgs{
+			Name:  pulumi.String("VAULT_CACERT"),
+			Value: pulumi.String("/vault/" + tlsCASecretName + "/ca.crt"),
+		})
+		snapshotMounts = append(snapshotMounts, pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String(tlsCASecretName),
+			MountPath: pulumi.String("/vault/" + tlsCASecretName),
+			ReadOnly:  pulumi.Bool(true),
+		})
+		volumes = append(volumes, pulumiv1.VolumeArgs{
+			Name: pulumi.String(tlsCASecretName),
+			Secret: pulumiv1.SecretVolumeSourceArgs{
+				SecretName: pulumi.String(tlsCASecretName),
+			},
+		})
+	}
+
+	_, err = pulumibatchv1.NewCronJob(
+		ctx,
+		snapshotName,
+		&pulumibatchv1.CronJobArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(snapshotName),
+				Namespace: namespace,
+			},
+			Spec: pulumibatchv1.CronJobSpecArgs{
+				Schedule:                   pulumi.String(snapshots.Schedule),
+				ConcurrencyPolicy:          pulumi.String("Forbid"),
+				SuccessfulJobsHistoryLimit: pulumi.Int(3),
+				FailedJobsHistoryLimit:     pulumi.Int(3),
+				JobTemplate: pulumibatchv1.JobTemplateSpecArgs{
+					Spec: pulumibatchv1.JobSpecArgs{
+						BackoffLimit: pulumi.Int(2),
+						Template: pulumiv1.PodTemplateSpecArgs{
+							Spec: pulumiv1.PodSpecArgs{
+								ServiceAccountName: serviceAccount.Metadata.Name(),
+								RestartPolicy:      pulumi.String("OnFailure"),
+								InitContainers: pulumiv1.ContainerArray{
+									pulumiv1.ContainerArgs{
+										Name:         pulumi.String("snapshot"),
+										Image:        pulumi.String("hashicorp/vault:" + args.ImageTag),
+										Command:      pulumi.ToStringArray([]string{"/bin/sh", "-c", snapshotScript()}),
+										Env:          snapshotEnv,
+										VolumeMounts: snapshotMounts,
+									},
+								},
+								Containers: pulumiv1.ContainerArray{
+									pulumiv1.ContainerArgs{
+										Name:    pulumi.String("upload"),
+										Image:   pulumi.String(snapshots.Image),
+										Command: pulumi.ToStringArray([]string{"/bin/sh", "-c", uploadScript(snapshots)}),
+										Env: pulumiv1.EnvVarArray{
+											pulumiv1.EnvVarArgs{
+												Name: pulumi.String("S3_ACCESS_KEY"),
+												ValueFrom: pulumiv1.EnvVarSourceArgs{
+													SecretKeyRef: pulumiv1.SecretKeySelectorArgs{
+														Name: credentials.Metadata.Name(),
+														Key:  pulumi.String("access-key"),
+													},
+												},
+											},
+											pulumiv1.EnvVarArgs{
+												Name: pulumi.String("S3_SECRET_KEY"),
+												ValueFrom: pulumiv1.EnvVarSourceArgs{
+													SecretKeyRef: pulumiv1.SecretKeySelectorArgs{
+														Name: credentials.Metadata.Name(),
+														Key:  pulumi.String("secret-key"),
+													},
+												},
+											},
+										},
+										VolumeMounts: pulumiv1.VolumeMountArray{
+											pulumiv1.VolumeMountArgs{
+												Name:      pulumi.String("snapshots"),
+												MountPath: pulumi.String("/snapshots"),
+												ReadOnly:  pulumi.Bool(true),
+											},
+										},
+									},
+								},
+								Volumes: volumes,
+							},
+						},
+					},
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	return err
+}
+
+func snapshotScript() string {
+	return fmt.Sprintf(`set -e
+jwt=$(cat /var/run/secrets/kubernetes.io/serviceaccount/token)
+export VAULT_TOKEN=$(vault write -field=token auth/kubernetes/login role=%s jwt="$jwt")
+vault operator raft snapshot save "/snapshots/vault-$(date +%%Y%%m%%d-%%H%%M%%S).snap"`,
+		snapshotName,
+	)
+}
+
+func uploadScript(args *SnapshotArgs) string {
+	target := fmt.Sprintf("backup/%s/%s/", args.Bucket, args.Prefix)
+
+	return fmt.Sprintf(`set -e
+export MC_CONFIG_DIR=/tmp/.mc
+mc alias set backup '%s' "$S3_ACCESS_KEY" "$S3_SECRET_KEY"
+mc cp /snapshots/*.snap '%s'
+mc rm --recursive --force --older-than %dd '%s'`,
+		args.Endpoint,
+		target,
+		args.RetentionDays,
+		target,
+	)
+}
+
+// configureSnapshots writes the snapshot policy and the Kubernetes auth role used by the snapshot CronJob in namespace.
+func configureSnapshots(pod *corev1.Pod, client *api.Client, namespace string) error {
+	policy, err := os.ReadFile("./vault/snapshot-policy.hcl")
+	if err != nil {
+		return err
+	}
+
+	err = enableAuthMethods(pod, client, "kubernetes")
+	if err != nil {
+		return err
+	}
+
+	if err := client.Sys().PutPolicy(snapshotName, string(policy)); err != nil {
+		return fmt.Errorf("configureSnapshots(%s): %w", pod.Name, err)
+	}
+
+	_, err = client.Logical().Write("auth/kubernetes/role/"+snapshotName, map[string]interface{}{
+		"bound_service_account_names":      snapshotName,
+		"bound_service_account_namespaces": namespace,
+		"token_policies":                   snapshotName,
+		"token_ttl":                        "10m",
+	})
+	if err != nil {
+		return fmt.Errorf("configureSnapshots(%s): %w", pod.Name, err)
+	}
+
+	return nil
+}
+
+// RestoreSnapshot restores a raft snapshot, e.g. one saved by the snapshot CronJob, into the Vault cluster in the
+// given namespace. The token needs the sudo capability on sys/storage/raft/snapshot-force, which the admin token has.
+//
+// To rebuild a lost cluster, deploy a new one, restore the snapshot with the admin token of the new cluster and
+// restart the Vault pods. The snapshot replaces the keyring and all tokens, so afterwards Vault is unsealed with the
+// unseal keys of the cluster the snapshot was taken from, and the new cluster's admin token is no longer valid. The
+// stack output vault-init-info has to be updated with the old keys and admin token, e.g. by restoring it from a backup
+// of the stack state.
+func RestoreSnapshot(namespace string, token string, snapshot io.Reader) error {
+	kc, err := common.NewKubernetesClient(namespace)
+	if err != nil {
+		return err
+	}
+
+	pods, err := kc.GetPodsWithLabel(podSelector + ",vault-active=true")
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no active Vault pod found in namespace %s", namespace)
+	}
+
+	pod := &pods[0]
+	nodes, err := newPortForwardNodes(listenerTLS(pod), kc)
+	if err != nil {
+		return err
+	}
+
+	client, release, err := nodes.connectWithToken(pod, token)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := client.Sys().RaftSnapshotRestore(snapshot, true); err != nil {
+		return fmt.Errorf("RestoreSnapshot(%s): %w", pod.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUploadScript(t *testing.T) {
+	script := uploadScript(&SnapshotArgs{
+		Endpoint:      "http://minio:9000",
+		Bucket:        "backups",
+		Prefix:        "vault",
+		RetentionDays: 14,
+	})
+
+	expected := []string{
+		`mc alias set backup 'http://minio:9000' "$S3_ACCESS_KEY" "$S3_SECRET_KEY"`,
+		`mc cp /snapshots/*.snap 'backup/backups/vault/'`,
+		`mc rm --recursive --force --older-than 14d 'backup/backups/vault/'`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(script, e) {
+			t.Fatalf("expected upload script to contain %s, got:\n%s", e, script)
+		}
+	}
+}
+
+func TestSnapshotScript(t *testing.T) {
+	script := snapshotScript()
+
+	expected := []string{
+		`vault write -field=token auth/kubernetes/login role=vault-snapshot`,
+		`vault operator raft snapshot save "/snapshots/vault-$(date +%Y%m%d-%H%M%S).snap"`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(script, e) {
+			t.Fatalf("expected snapshot script to contain %s, got:\n%s", e, script)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package vault
+
+import (
+	"fmt"
+	"github.com/haikoschol/ort-server-pulumi-go/certmanager"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi-tls/sdk/v4/go/tls"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	tlsServerSecretName = "tls-server"
+	tlsCASecretName     = "tls-ca"
+	// tlsIssuedSecretName is the secret cert-manager stores the certificate for all nodes in. It differs from
+	// tlsServerSecretName, so that switching to cert-manager does not delete the issued certificate.
+	tlsIssuedSecretName = "tls-server-issued"
+	// The Helm chart mounts the secrets listed in server.extraVolumes below this directory.
+	userConfigDir = "/vault/userconfig"
+)
+
+// TLSArgs configures the certificates of the Vault listener, which are also used for raft cluster traffic.
+type TLSArgs struct {
+	// CACert and CAKey are the PEM encoded certificate and private key of the CA that signs the node certificates. A
+	// self-signed CA is created if they are empty.
+	CACert string
+	CAKey  pulumi.StringInput
+	// ValidityHours is how long the node certificates are valid. They are renewed by the first deployment within the
+	// last tenth of that period.
+	ValidityHours int
+	// Issuer issues a single certificate for all nodes instead if not nil. CACert and ValidityHours are ignored then.
+	Issuer *certmanager.Issuer
+}
+
+// tlsFiles holds the paths of the certificates inside the Vault pods. HOSTNAME is replaced with the pod name by the
+// Helm chart before Vault reads its configuration.
+type tlsFiles struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+func newTLSFiles(args *TLSArgs) *tlsFiles {
+	if args.Issuer != nil {
+		return &tlsFiles{
+			CertFile: fmt.Sprintf("%s/%s/tls.crt", userConfigDir, tlsIssuedSecretName),
+			KeyFile:  fmt.Sprintf("%s/%s/tls.key", userConfigDir, tlsIssuedSecretName),
+			CAFile:   fmt.Sprintf("%s/%s/ca.crt", userConfigDir, tlsCASecretName),
+		}
+	}
+
+	return &tlsFiles{
+		CertFile: fmt.Sprintf("%s/%s/HOSTNAME.crt", userConfigDir, tlsServerSecretName),
+		KeyFile:  fmt.Sprintf("%s/%s/HOSTNAME.key", userConfigDir, tlsServerSecretName),
+		CAFile:   fmt.Sprintf("%s/%s/ca.crt", userConfigDir, tlsCASecretName),
+	}
+}
+
+// serverSecretName returns the name of the secret with the server certificates.
+func serverSecretName(args *TLSArgs) string {
+	if args.Issuer != nil {
+		return tlsIssuedSecretName
+	}
+	return tlsServerSecretName
+}
+
+// tlsReloadContainer returns a sidecar that sends SIGHUP to Vault when cert-manager has renewed the certificate.
+// Vault reads the certificate of its listener only on startup and on SIGHUP, so it would serve the expired one. The
+// Helm chart names the volumes of server.extraVolumes "userconfig-<name>".
+func tlsReloadContainer(args *ClusterArgs) pulumi.Map {
+	return pulumi.Map{
+		"name":    pulumi.String("tls-reload"),
+		"image":   pulumi.String("hashicorp/vault:" + args.ImageTag),
+		"command": pulumi.ToStringArray([]string{"/bin/sh", "-c", tlsReloadScript(newTLSFiles(args.TLS).CertFile)}),
+		"volumeMounts": pulumi.MapArray{
+			pulumi.Map{
+				"name":      pulumi.String("userconfig-" + tlsIssuedSecretName),
+				"mountPath": pulumi.String(userConfigDir + "/" + tlsIssuedSecretName),
+				"readOnly":  pulumi.Bool(true),
+			},
+		},
+	}
+}
+
+func tlsReloadScript(certFile string) string {
+	return fmt.Sprintf(`cert='%s'
+last=$(md5sum "$cert")
+while true; do
+  sleep 60
+  current=$(md5sum "$cert") || continue
+  if [ "$current" != "$last" ]; then
+    pkill -HUP -x vault
+    last="$current"
+  fi
+done`,
+		certFile,
+	)
+}
+
+// createTLS creates a certificate for every Vault node, signed by the configured CA or a self-signed one, and stores
+// them in the secrets tls-server and tls-ca.
+func createTLS(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) ([]pulumi.Resource, error) {
+	if args.TLS.Issuer != nil {
+		return requestCertificate(ctx, component, args)
+	}
+
+	caCert, caKey, err := createCA(ctx, component, args.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := args.Namespace.Metadata.Name().Elem()
+	serverData := pulumi.StringMap{}
+
+	for _, node := range nodeNames(args.Replicas) {
+		key, err := tls.NewPrivateKey(
+			ctx,
+			fmt.Sprintf("vault-tls-%s", node),
+			&tls.PrivateKeyArgs{
+				Algorithm:  pulumi.String("ECDSA"),
+				EcdsaCurve: pulumi.String("P256"),
+			},
+			pulumi.ResourceOption(pulumi.Parent(component)),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		request, err := tls.NewCertRequest(
+			ctx,
+			fmt.Sprintf("vault-tls-%s", node),
+			&tls.CertRequestArgs{
+				PrivateKeyPem: key.PrivateKeyPem,
+				Subject: tls.CertRequestSubjectArgs{
+					CommonName: pulumi.String(node),
+				},
+				DnsNames: append(nodeDNSNames(node, namespace), serviceDNSNames(namespace)...),
+				IpAddresses: pulumi.StringArray{
+					pulumi.String("127.0.0.1"),
+				},
+			},
+			pulumi.ResourceOption(pulumi.Parent(component)),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.NewLocallySignedCert(
+			ctx,
+			fmt.Sprintf("vault-tls-%s", node),
+			&tls.LocallySignedCertArgs{
+				CertRequestPem:      request.CertRequestPem,
+				CaCertPem:           caCert,
+				CaPrivateKeyPem:     caKey,
+				ValidityPeriodHours: pulumi.Int(args.TLS.ValidityHours),
+				EarlyRenewalHours:   pulumi.Int(args.TLS.ValidityHours / 10),
+				AllowedUses: pulumi.StringArray{
+					pulumi.String("digital_signature"),
+					pulumi.String("key_encipherment"),
+					pulumi.String("server_auth"),
+					pulumi.String("client_auth"),
+				},
+			},
+			pulumi.ResourceOption(pulumi.Parent(component)),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		serverData[node+".crt"] = cert.CertPem
+		serverData[node+".key"] = key.PrivateKeyPem
+	}
+
+	component.tlsServerSecret, err = newTLSSecret(ctx, component, args, tlsServerSecretName, serverData)
+	if err != nil {
+		return nil, err
+	}
+
+	caSecret, err := newTLSSecret(ctx, component, args, tlsCASecretName, pulumi.StringMap{"ca.crt": caCert})
+	if err != nil {
+		return nil, err
+	}
+
+	return []pulumi.Resource{component.tlsServerSecret, caSecret}, nil
+}
+
+// requestCertificate requests a certificate for all Vault nodes from cert-manager and stores the CA certificate of the
+// issuer in the secret tls-ca.
+func requestCertificate(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) ([]pulumi.Resource, error) {
+	namespace := args.Namespace.Metadata.Name().Elem()
+
+	var dnsNames pulumi.StringArray
+	for _, node := range nodeNames(args.Replicas) {
+		dnsNames = append(dnsNames, nodeDNSNames(node, namespace)...)
+	}
+	dnsNames = append(dnsNames, serviceDNSNames(namespace)...)
+
+	cert, err := certmanager.NewCertificate(
+		ctx,
+		"vault-tls",
+		args.TLS.Issuer,
+		&certmanager.CertificateArgs{
+			Namespace:   namespace,
+			SecretName:  tlsIssuedSecretName,
+			CommonName:  pulumi.String(fullName),
+			DNSNames:    dnsNames,
+			IPAddresses: []string{"127.0.0.1"},
+			// The nodes authenticate with the certificate when joining the raft cluster.
+			ClientAuth: true,
+		},
+		pulumi.Parent(component),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	caSecret, err := newTLSSecret(ctx, component, args, tlsCASecretName, pulumi.StringMap{
+		"ca.crt": args.TLS.Issuer.CACert,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []pulumi.Resource{cert, caSecret}, nil
+}
+
+func createCA(ctx *pulumi.Context, component *Cluster, args *TLSArgs) (pulumi.StringInput, pulumi.StringInput, error) {
+	if args.CACert != "" {
+		return pulumi.String(args.CACert), args.CAKey, nil
+	}
+
+	key, err := tls.NewPrivateKey(
+		ctx,
+		"vault-tls-ca",
+		&tls.PrivateKeyArgs{
+			Algorithm:  pulumi.String("ECDSA"),
+			EcdsaCurve: pulumi.String("P256"),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := tls.NewSelfSignedCert(
+		ctx,
+		"vault-tls-ca",
+		&tls.SelfSignedCertArgs{
+			PrivateKeyPem: key.PrivateKeyPem,
+			Subject: tls.SelfSignedCertSubjectArgs{
+				CommonName:   pulumi.String("Vault CA"),
+				Organization: pulumi.String("ORT Server"),
+			},
+			IsCaCertificate: pulumi.Bool(true),
+			// The CA outlives the node certificates, so that renewing them does not require distributing a new CA.
+			ValidityPeriodHours: pulumi.Int(args.ValidityHours * 10),
+			AllowedUses: pulumi.StringArray{
+				pulumi.String("cert_signing"),
+				pulumi.String("crl_signing"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert.CertPem, key.PrivateKeyPem, nil
+}
+
+// nodeDNSNames returns the names under which a Vault node is reachable via the headless service, which is used for raft
+// and by the unsealer.
+func nodeDNSNames(node string, namespace pulumi.StringOutput) pulumi.StringArray {
+	internal := fullName + "-internal"
+
+	return pulumi.StringArray{
+		pulumi.String(node),
+		pulumi.Sprintf("%s.%s", node, internal),
+		pulumi.Sprintf("%s.%s.%s.svc", node, internal, namespace),
+		pulumi.Sprintf("%s.%s.%s.svc.cluster.local", node, internal, namespace),
+	}
+}
+
+// serviceDNSNames returns the names under which clients reach any Vault node via the regular services, including the
+// service of the web UI.
+func serviceDNSNames(namespace pulumi.StringOutput) pulumi.StringArray {
+	return pulumi.StringArray{
+		pulumi.String(fullName),
+		pulumi.Sprintf("%s.%s", fullName, namespace),
+		pulumi.Sprintf("%s.%s.svc", fullName, namespace),
+		pulumi.Sprintf("%s.%s.svc.cluster.local", fullName, namespace),
+		pulumi.Sprintf("%s-active.%s.svc", fullName, namespace),
+		pulumi.String(fullName + "-ui"),
+		pulumi.Sprintf("%s-ui.%s.svc", fullName, namespace),
+		pulumi.String("localhost"),
+	}
+}
+
+func newTLSSecret(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+	name string,
+	data pulumi.StringMap,
+) (*pulumiv1.Secret, error) {
+	return pulumiv1.NewSecret(
+		ctx,
+		"vault-"+name,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(name),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			StringData: data,
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+}
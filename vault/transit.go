@@ -0,0 +1,262 @@
+package vault
+
+import (
+	"fmt"
+	pulumiappsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"strings"
+)
+
+const (
+	transitTokenSecretName = "vault-transit-token"
+	transitCASecretName    = "vault-transit-ca"
+	transitStandInName     = "vault-transit"
+	// systemCAFile is the bundle of public CA certificates in the Vault image.
+	systemCAFile = "/etc/ssl/certs/ca-certificates.crt"
+)
+
+// TransitSealArgs configures Vault to unseal itself with the transit secrets engine of another Vault, so that restarted
+// pods don't stay sealed until the next deployment.
+type TransitSealArgs struct {
+	// Address of the Vault providing the transit engine. It must be empty if DevMode is true.
+	Address string `json:"address"`
+	// DevMode deploys a Vault in dev mode next to the cluster and uses it instead. The dev mode Vault keeps everything
+	// in memory, so when its pod restarts the encryption key is lost and the cluster can't be unsealed anymore. It is
+	// only meant for testing.
+	DevMode   bool   `json:"devMode"`
+	MountPath string `json:"mountPath"`
+	KeyName   string `json:"keyName"`
+	// Token is used to access the transit engine. It needs a policy granting update on "<MountPath>/encrypt/<KeyName>"
+	// and "<MountPath>/decrypt/<KeyName>". Ignored for the dev mode Vault.
+	Token         pulumi.StringInput `json:"-"`
+	TLSSkipVerify bool               `json:"tlsSkipVerify"`
+	// TLSCACert is the PEM encoded CA certificate the certificate of the transit Vault is verified with. If empty, the
+	// public CAs trusted by the Vault image are used.
+	TLSCACert string `json:"tlsCACert"`
+}
+
+// CAFile returns the path of the CA certificates the transit Vault is verified with, or an empty string if it is not
+// accessed via HTTPS. It has to be set explicitly, because the seal would use VAULT_CACERT, the CA of the cluster.
+func (t TransitSealArgs) CAFile() string {
+	if !strings.HasPrefix(t.Address, "https://") {
+		return ""
+	}
+	if t.TLSCACert != "" {
+		return fmt.Sprintf("%s/%s/ca.crt", userConfigDir, transitCASecretName)
+	}
+	return systemCAFile
+}
+
+// createTransitSeal creates the secrets holding the token and CA certificate for the transit engine and, in dev mode,
+// the Vault providing it. The returned resources need to be ready before the Vault cluster starts.
+func createTransitSeal(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+) (*TransitSealArgs, []pulumi.Resource, error) {
+	transit := *args.TransitSeal
+	token := transit.Token
+
+	var dependencies []pulumi.Resource
+
+	if transit.DevMode {
+		_ = ctx.Log.Warn(
+			"Vault is unsealed by a dev mode Vault, which loses its key when its pod restarts. Don't use it in production.",
+			nil,
+		)
+
+		rootToken, err := random.NewRandomPassword(
+			ctx,
+			"vault-transit-root-token",
+			&random.RandomPasswordArgs{
+				Length:  pulumi.Int(32),
+				Special: pulumi.Bool(false),
+			},
+			pulumi.ResourceOption(pulumi.Parent(component)),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		token = rootToken.Result
+		transit.Address = fmt.Sprintf("http://%s:8200", transitStandInName)
+		transit.TLSSkipVerify = false
+	}
+
+	secret, err := pulumiv1.NewSecret(
+		ctx,
+		transitTokenSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(transitTokenSecretName),
+				Namespace: args.Namespace.Metadata.Name(),
+			},
+			StringData: pulumi.StringMap{
+				"token": token,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	dependencies = append(dependencies, secret)
+
+	if transit.TLSCACert != "" {
+		caSecret, err := pulumiv1.NewSecret(
+			ctx,
+			transitCASecretName,
+			&pulumiv1.SecretArgs{
+				Metadata: pulumimetav1.ObjectMetaArgs{
+					Name:      pulumi.String(transitCASecretName),
+					Namespace: args.Namespace.Metadata.Name(),
+				},
+				StringData: pulumi.StringMap{
+					"ca.crt": pulumi.String(transit.TLSCACert),
+				},
+			},
+			pulumi.ResourceOption(pulumi.Parent(component)),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		dependencies = append(dependencies, caSecret)
+	}
+
+	if transit.DevMode {
+		standIn, err := createTransitStandIn(ctx, component, args, &transit, secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		dependencies = append(dependencies, standIn...)
+	}
+
+	return &transit, dependencies, nil
+}
+
+// createTransitStandIn deploys a single Vault in dev mode with the transit engine enabled. Its root token is read from
+// the given secret.
+func createTransitStandIn(
+	ctx *pulumi.Context,
+	component *Cluster,
+	args *ClusterArgs,
+	transit *TransitSealArgs,
+	tokenSecret *pulumiv1.Secret,
+) ([]pulumi.Resource, error) {
+	labels := pulumi.StringMap{
+		"app.kubernetes.io/name": pulumi.String(transitStandInName),
+	}
+
+	setupScript := fmt.Sprintf(
+		`export VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN="$VAULT_DEV_ROOT_TOKEN_ID"
+until vault status > /dev/null 2>&1; do sleep 1; done
+vault secrets enable -path=%s transit
+vault write -f %s/keys/%s`,
+		transit.MountPath,
+		transit.MountPath,
+		transit.KeyName,
+	)
+
+	deployment, err := pulumiappsv1.NewDeployment(
+		ctx,
+		transitStandInName,
+		&pulumiappsv1.DeploymentArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(transitStandInName),
+				Namespace: args.Namespace.Metadata.Name(),
+				Labels:    labels,
+			},
+			Spec: pulumiappsv1.DeploymentSpecArgs{
+				Replicas: pulumi.Int(1),
+				Selector: pulumimetav1.LabelSelectorArgs{
+					MatchLabels: labels,
+				},
+				Template: pulumiv1.PodTemplateSpecArgs{
+					Metadata: pulumimetav1.ObjectMetaArgs{
+						Labels: labels,
+					},
+					Spec: pulumiv1.PodSpecArgs{
+						Containers: pulumiv1.ContainerArray{
+							pulumiv1.ContainerArgs{
+								Name:  pulumi.String("vault"),
+								Image: pulumi.String("hashicorp/vault:" + args.ImageTag),
+								Env: pulumiv1.EnvVarArray{
+									pulumiv1.EnvVarArgs{
+										Name:  pulumi.String("VAULT_DEV_LISTEN_ADDRESS"),
+										Value: pulumi.String("0.0.0.0:8200"),
+									},
+									pulumiv1.EnvVarArgs{
+										Name:  pulumi.String("SKIP_SETCAP"),
+										Value: pulumi.String("true"),
+									},
+									pulumiv1.EnvVarArgs{
+										Name: pulumi.String("VAULT_DEV_ROOT_TOKEN_ID"),
+										ValueFrom: pulumiv1.EnvVarSourceArgs{
+											SecretKeyRef: pulumiv1.SecretKeySelectorArgs{
+												Name: tokenSecret.Metadata.Name(),
+												Key:  pulumi.String("token"),
+											},
+										},
+									},
+								},
+								Ports: pulumiv1.ContainerPortArray{
+									pulumiv1.ContainerPortArgs{
+										ContainerPort: pulumi.Int(8200),
+									},
+								},
+								Lifecycle: pulumiv1.LifecycleArgs{
+									PostStart: pulumiv1.LifecycleHandlerArgs{
+										Exec: pulumiv1.ExecActionArgs{
+											Command: pulumi.ToStringArray([]string{"/bin/sh", "-c", setupScript}),
+										},
+									},
+								},
+								ReadinessProbe: pulumiv1.ProbeArgs{
+									HttpGet: pulumiv1.HTTPGetActionArgs{
+										Path: pulumi.String("/v1/sys/health"),
+										Port: pulumi.Int(8200),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := pulumiv1.NewService(
+		ctx,
+		transitStandInName,
+		&pulumiv1.ServiceArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(transitStandInName),
+				Namespace: args.Namespace.Metadata.Name(),
+				Labels:    labels,
+			},
+			Spec: pulumiv1.ServiceSpecArgs{
+				Ports: pulumiv1.ServicePortArray{
+					pulumiv1.ServicePortArgs{
+						Name:       pulumi.String("http"),
+						Port:       pulumi.Int(8200),
+						TargetPort: pulumi.Int(8200),
+					},
+				},
+				Selector: labels,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return []pulumi.Resource{deployment, service}, nil
+}
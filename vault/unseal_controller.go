@@ -0,0 +1,223 @@
+package vault
+
+import (
+	pulumiappsv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/apps/v1"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
+	pulumimetav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
+	pulumirbacv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/rbac/v1"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	unsealControllerName = "vault-unseal-controller"
+	unsealKeysSecretName = "vault-unseal-keys"
+)
+
+// UnsealControllerArgs configures the controller that unseals restarted Vault pods, see the unsealcontroller package.
+type UnsealControllerArgs struct {
+	// Image is built from cmd/vault-unseal-controller/Dockerfile.
+	Image string `json:"image"`
+	// ResyncInterval is how often all pods are checked regardless of changes, e.g. "30s".
+	ResyncInterval string `json:"resyncInterval"`
+}
+
+// createUnsealController stores the unseal keys in a secret and deploys the unseal controller with permission to watch
+// the Vault pods and to report events.
+func createUnsealController(ctx *pulumi.Context, component *Cluster, args *ClusterArgs) error {
+	namespace := args.Namespace.Metadata.Name()
+	labels := pulumi.StringMap{
+		"app.kubernetes.io/name": pulumi.String(unsealControllerName),
+	}
+
+	keysSecret, err := pulumiv1.NewSecret(
+		ctx,
+		unsealKeysSecretName,
+		&pulumiv1.SecretArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(unsealKeysSecretName),
+				Namespace: namespace,
+			},
+			StringData: component.unsealer.unsealKeysOutput(),
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	serviceAccount, err := pulumiv1.NewServiceAccount(
+		ctx,
+		unsealControllerName,
+		&pulumiv1.ServiceAccountArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(unsealControllerName),
+				Namespace: namespace,
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	role, err := pulumirbacv1.NewRole(
+		ctx,
+		unsealControllerName,
+		&pulumirbacv1.RoleArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(unsealControllerName),
+				Namespace: namespace,
+			},
+			Rules: pulumirbacv1.PolicyRuleArray{
+				pulumirbacv1.PolicyRuleArgs{
+					ApiGroups: pulumi.ToStringArray([]string{""}),
+					Resources: pulumi.ToStringArray([]string{"pods"}),
+					Verbs:     pulumi.ToStringArray([]string{"get", "list", "watch"}),
+				},
+				pulumirbacv1.PolicyRuleArgs{
+					ApiGroups: pulumi.ToStringArray([]string{""}),
+					Resources: pulumi.ToStringArray([]string{"events"}),
+					Verbs:     pulumi.ToStringArray([]string{"create", "patch"}),
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = pulumirbacv1.NewRoleBinding(
+		ctx,
+		unsealControllerName,
+		&pulumirbacv1.RoleBindingArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(unsealControllerName),
+				Namespace: namespace,
+			},
+			Subjects: pulumirbacv1.SubjectArray{
+				pulumirbacv1.SubjectArgs{
+					Kind:      pulumi.String("ServiceAccount"),
+					Name:      serviceAccount.Metadata.Name().Elem(),
+					Namespace: namespace,
+				},
+			},
+			RoleRef: pulumirbacv1.RoleRefArgs{
+				Kind:     pulumi.String("Role"),
+				Name:     role.Metadata.Name().Elem(),
+				ApiGroup: pulumi.String("rbac.authorization.k8s.io"),
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	if err != nil {
+		return err
+	}
+
+	env := pulumiv1.EnvVarArray{
+		pulumiv1.EnvVarArgs{
+			Name: pulumi.String("NAMESPACE"),
+			ValueFrom: pulumiv1.EnvVarSourceArgs{
+				FieldRef: pulumiv1.ObjectFieldSelectorArgs{
+					FieldPath: pulumi.String("metadata.namespace"),
+				},
+			},
+		},
+		pulumiv1.EnvVarArgs{
+			Name:  pulumi.String("POD_SELECTOR"),
+			Value: pulumi.String(podSelector),
+		},
+		pulumiv1.EnvVarArgs{
+			Name:  pulumi.String("VAULT_INTERNAL_SERVICE"),
+			Value: pulumi.String(fullName + "-internal"),
+		},
+		pulumiv1.EnvVarArgs{
+			Name:  pulumi.String("UNSEAL_KEYS_DIR"),
+			Value: pulumi.String("/vault/unseal-keys"),
+		},
+		pulumiv1.EnvVarArgs{
+			Name:  pulumi.String("RESYNC_INTERVAL"),
+			Value: pulumi.String(args.UnsealController.ResyncInterval),
+		},
+	}
+
+	volumeMounts := pulumiv1.VolumeMountArray{
+		pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String("unseal-keys"),
+			MountPath: pulumi.String("/vault/unseal-keys"),
+			ReadOnly:  pulumi.Bool(true),
+		},
+	}
+
+	volumes := pulumiv1.VolumeArray{
+		pulumiv1.VolumeArgs{
+			Name: pulumi.String("unseal-keys"),
+			Secret: pulumiv1.SecretVolumeSourceArgs{
+				SecretName: keysSecret.Metadata.Name(),
+			},
+		},
+	}
+
+	if args.TLS != nil {
+		caFile := "/vault/" + tlsCASecretName + "/ca.crt"
+		env = append(
+			env,
+			pulumiv1.EnvVarArgs{
+				Name:  pulumi.String("VAULT_SCHEME"),
+				Value: pulumi.String("https"),
+			},
+			pulumiv1.EnvVarArgs{
+				Name:  pulumi.String("VAULT_CACERT"),
+				Value: pulumi.String(caFile),
+			},
+		)
+		volumeMounts = append(volumeMounts, pulumiv1.VolumeMountArgs{
+			Name:      pulumi.String(tlsCASecretName),
+			MountPath: pulumi.String("/vault/" + tlsCASecretName),
+			ReadOnly:  pulumi.Bool(true),
+		})
+		volumes = append(volumes, pulumiv1.VolumeArgs{
+			Name: pulumi.String(tlsCASecretName),
+			Secret: pulumiv1.SecretVolumeSourceArgs{
+				SecretName: pulumi.String(tlsCASecretName),
+			},
+		})
+	}
+
+	_, err = pulumiappsv1.NewDeployment(
+		ctx,
+		unsealControllerName,
+		&pulumiappsv1.DeploymentArgs{
+			Metadata: pulumimetav1.ObjectMetaArgs{
+				Name:      pulumi.String(unsealControllerName),
+				Namespace: namespace,
+				Labels:    labels,
+			},
+			Spec: pulumiappsv1.DeploymentSpecArgs{
+				Replicas: pulumi.Int(1),
+				Selector: pulumimetav1.LabelSelectorArgs{
+					MatchLabels: labels,
+				},
+				Template: pulumiv1.PodTemplateSpecArgs{
+					Metadata: pulumimetav1.ObjectMetaArgs{
+						Labels: labels,
+					},
+					Spec: pulumiv1.PodSpecArgs{
+						ServiceAccountName: serviceAccount.Metadata.Name(),
+						Containers: pulumiv1.ContainerArray{
+							pulumiv1.ContainerArgs{
+								Name:         pulumi.String("controller"),
+								Image:        pulumi.String(args.UnsealController.Image),
+								Env:          env,
+								VolumeMounts: volumeMounts,
+							},
+						},
+						Volumes: volumes,
+					},
+				},
+			},
+		},
+		pulumi.ResourceOption(pulumi.Parent(component)),
+	)
+	return err
+}
@@ -0,0 +1,226 @@
+// Package unsealcontroller implements a controller that keeps the pods of a Vault cluster with Shamir seal unsealed.
+// It watches the Vault pods and, whenever one of them is sealed, unseals it with keys read from a directory, usually a
+// mounted Kubernetes Secret. Pods that are not initialised yet are joined to the raft cluster first. Every action is
+// reported as a Kubernetes Event on the affected pod.
+package unsealcontroller
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type Config struct {
+	Namespace string
+	// InternalService is the name of the headless service of the Vault pods, used to address them individually.
+	InternalService string
+	// Scheme is either "http" or "https".
+	Scheme string
+	// KeysDir is a directory containing one unseal key per file. Files are read in lexical order.
+	KeysDir string
+	// CACert is the PEM encoded CA certificate Vault's listener certificates are signed with. Only used with "https".
+	CACert string
+}
+
+type Controller struct {
+	config    Config
+	clientset kubernetes.Interface
+	recorder  record.EventRecorder
+	vault     *vaultClient
+	// address returns the base URL of the Vault API on the given pod.
+	address func(pod *corev1.Pod) string
+}
+
+// New returns a controller that talks to the Vault pods with clones of vault, which carries the TLS settings. Its
+// address is replaced with the one of the pod.
+func New(config Config, clientset kubernetes.Interface, recorder record.EventRecorder, vault *api.Client) *Controller {
+	c := &Controller{
+		config:    config,
+		clientset: clientset,
+		recorder:  recorder,
+		vault:     &vaultClient{base: vault},
+	}
+
+	c.address = func(pod *corev1.Pod) string {
+		return fmt.Sprintf("%s://%s.%s:8200", c.config.Scheme, pod.Name, c.config.InternalService)
+	}
+
+	return c
+}
+
+// Run watches the pods matching selector and reconciles them whenever they change and once per resync period, until
+// ctx is done.
+func (c *Controller) Run(ctx context.Context, selector string, resync time.Duration) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		c.clientset,
+		resync,
+		informers.WithNamespace(c.config.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		}),
+	)
+
+	podInformer := factory.Core().V1().Pods()
+	lister := podInformer.Lister().Pods(c.config.Namespace)
+
+	handle := func(obj interface{}) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return
+		}
+
+		pods, err := lister.List(labels.Everything())
+		if err != nil {
+			log.Printf("listing pods: %v", err)
+			return
+		}
+
+		c.Reconcile(ctx, pod, pods)
+	}
+
+	_, err := podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: handle,
+		UpdateFunc: func(_, obj interface{}) {
+			handle(obj)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync informer for %v", informerType)
+		}
+	}
+
+	<-ctx.Done()
+	factory.Shutdown()
+	return nil
+}
+
+// Reconcile checks the given pod and unseals or joins it if necessary. The other pods are needed to find a member of
+// the raft cluster the pod can join.
+func (c *Controller) Reconcile(ctx context.Context, pod *corev1.Pod, pods []*corev1.Pod) {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return
+	}
+
+	address := c.address(pod)
+	status, err := c.vault.health(ctx, address)
+	if err != nil {
+		log.Printf("checking health of %s: %v", pod.Name, err)
+		return
+	}
+
+	if !status.Initialized {
+		leader := c.findActiveMember(ctx, pod, pods)
+		if leader == "" {
+			log.Printf("%s is not initialised and there is no unsealed member to join", pod.Name)
+			return
+		}
+
+		err = c.vault.raftJoin(ctx, address, leader, c.config.CACert)
+		if err != nil {
+			c.recorder.Eventf(pod, corev1.EventTypeWarning, "RaftJoinFailed", "Joining %s failed: %v", leader, err)
+			return
+		}
+		c.recorder.Eventf(pod, corev1.EventTypeNormal, "RaftJoined", "Joined raft cluster via %s", leader)
+		status.Sealed = true
+	}
+
+	if !status.Sealed {
+		return
+	}
+
+	err = c.unseal(ctx, address)
+	if err != nil {
+		c.recorder.Eventf(pod, corev1.EventTypeWarning, "UnsealFailed", "Unsealing failed: %v", err)
+		return
+	}
+	c.recorder.Event(pod, corev1.EventTypeNormal, "Unsealed", "Vault was sealed and has been unsealed")
+}
+
+func (c *Controller) unseal(ctx context.Context, address string) error {
+	keys, err := c.readKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		status, err := c.vault.unseal(ctx, address, key)
+		if err != nil {
+			return err
+		}
+		if !status.Sealed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("still sealed after providing all %d keys", len(keys))
+}
+
+func (c *Controller) readKeys() ([]string, error) {
+	entries, err := os.ReadDir(c.config.KeysDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		// Mounted secrets contain hidden directories and symlinks managed by the kubelet.
+		if e.Name()[0] == '.' {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	var keys []string
+	for _, name := range names {
+		key, err := os.ReadFile(filepath.Join(c.config.KeysDir, name))
+		if err != nil {
+			return nil, err
+		}
+		if len(key) > 0 {
+			keys = append(keys, string(key))
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no unseal keys found in %s", c.config.KeysDir)
+	}
+
+	return keys, nil
+}
+
+// findActiveMember returns the address of an initialised and unsealed pod other than the given one, or an empty
+// string.
+func (c *Controller) findActiveMember(ctx context.Context, pod *corev1.Pod, pods []*corev1.Pod) string {
+	for _, p := range pods {
+		if p.Name == pod.Name || p.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		address := c.address(p)
+		status, err := c.vault.health(ctx, address)
+		if err == nil && status.Initialized && !status.Sealed {
+			return address
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,149 @@
+package unsealcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/haikoschol/ort-server-pulumi-go/common"
+	"github.com/hashicorp/vault/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault simulates a single Vault node with a threshold of two unseal keys.
+type fakeVault struct {
+	mu          sync.Mutex
+	initialized bool
+	sealed      bool
+	keys        []string
+	joined      string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/sys/health":
+		_ = json.NewEncoder(w).Encode(api.HealthResponse{Initialized: v.initialized, Sealed: v.sealed})
+	case "/v1/sys/unseal":
+		var body api.UnsealOpts
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		v.keys = append(v.keys, body.Key)
+		if len(v.keys) >= 2 {
+			v.sealed = false
+		}
+		_ = json.NewEncoder(w).Encode(api.SealStatusResponse{Sealed: v.sealed, T: 2, Progress: len(v.keys)})
+	case "/v1/sys/storage/raft/join":
+		var body api.RaftJoinRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		v.joined = body.LeaderAPIAddr
+		v.initialized = true
+		_, _ = w.Write([]byte(`{"joined": true}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func pod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ort-server"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+// newTestController returns a controller that addresses the pods by their name in servers.
+func newTestController(t *testing.T, servers map[string]*httptest.Server) (*Controller, *record.FakeRecorder) {
+	keysDir := t.TempDir()
+	for name, key := range map[string]string{"key-1": "first", "key-2": "second", "key-3": "third"} {
+		if err := os.WriteFile(filepath.Join(keysDir, name), []byte(key), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	vault, err := common.NewVaultClient("http://127.0.0.1:8200", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(Config{KeysDir: keysDir}, nil, recorder, vault)
+	c.address = func(pod *corev1.Pod) string {
+		return servers[pod.Name].URL
+	}
+
+	return c, recorder
+}
+
+func TestReconcileUnsealsSealedPod(t *testing.T) {
+	vault := &fakeVault{initialized: true, sealed: true}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	c, recorder := newTestController(t, map[string]*httptest.Server{"vault-1": server})
+	p := pod("vault-1")
+	c.Reconcile(context.Background(), p, []*corev1.Pod{p})
+
+	if vault.sealed {
+		t.Fatalf("expected the pod to be unsealed")
+	}
+	if len(vault.keys) != 2 || vault.keys[0] != "first" || vault.keys[1] != "second" {
+		t.Fatalf("expected the first two keys to be used in order, got %v", vault.keys)
+	}
+
+	event := <-recorder.Events
+	if !strings.Contains(event, "Unsealed") {
+		t.Fatalf("expected an Unsealed event, got %s", event)
+	}
+}
+
+func TestReconcileJoinsUninitializedPod(t *testing.T) {
+	leader := httptest.NewServer(&fakeVault{initialized: true, sealed: false})
+	defer leader.Close()
+
+	follower := &fakeVault{initialized: false, sealed: true}
+	followerServer := httptest.NewServer(follower)
+	defer followerServer.Close()
+
+	c, recorder := newTestController(t, map[string]*httptest.Server{"vault-0": leader, "vault-1": followerServer})
+	p := pod("vault-1")
+	c.Reconcile(context.Background(), p, []*corev1.Pod{pod("vault-0"), p})
+
+	if follower.joined != leader.URL {
+		t.Fatalf("expected the pod to join %s, got %q", leader.URL, follower.joined)
+	}
+	if follower.sealed {
+		t.Fatalf("expected the pod to be unsealed after joining")
+	}
+
+	for _, reason := range []string{"RaftJoined", "Unsealed"} {
+		event := <-recorder.Events
+		if !strings.Contains(event, reason) {
+			t.Fatalf("expected a %s event, got %s", reason, event)
+		}
+	}
+}
+
+func TestReconcileIgnoresUnsealedPod(t *testing.T) {
+	vault := &fakeVault{initialized: true, sealed: false}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	c, recorder := newTestController(t, map[string]*httptest.Server{"vault-0": server})
+	p := pod("vault-0")
+	c.Reconcile(context.Background(), p, []*corev1.Pod{p})
+
+	if len(vault.keys) != 0 {
+		t.Fatalf("expected no unseal attempt, got %v", vault.keys)
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("expected no events, got %d", len(recorder.Events))
+	}
+}
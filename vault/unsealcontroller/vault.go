@@ -0,0 +1,60 @@
+package unsealcontroller
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+)
+
+// vaultClient talks to the Vault API of individual pods, with the TLS settings of a base client.
+type vaultClient struct {
+	base *api.Client
+}
+
+// at returns a client for the Vault node at address.
+func (vc *vaultClient) at(address string) (*api.Client, error) {
+	client, err := vc.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SetAddress(address); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// health returns the status of the Vault node at address. Sealed, uninitialised and standby nodes are not errors.
+func (vc *vaultClient) health(ctx context.Context, address string) (*api.HealthResponse, error) {
+	client, err := vc.at(address)
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().HealthWithContext(ctx)
+}
+
+func (vc *vaultClient) unseal(ctx context.Context, address string, key string) (*api.SealStatusResponse, error) {
+	client, err := vc.at(address)
+	if err != nil {
+		return nil, err
+	}
+	return client.Sys().UnsealWithContext(ctx, key)
+}
+
+func (vc *vaultClient) raftJoin(ctx context.Context, address string, leaderAddress string, leaderCACert string) error {
+	client, err := vc.at(address)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Sys().RaftJoinWithContext(ctx, &api.RaftJoinRequest{
+		LeaderAPIAddr: leaderAddress,
+		LeaderCACert:  leaderCACert,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Joined {
+		return fmt.Errorf("vault did not join the raft cluster")
+	}
+	return nil
+}
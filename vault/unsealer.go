@@ -1,7 +1,6 @@
 package vault
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/haikoschol/ort-server-pulumi-go/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
@@ -14,9 +13,18 @@ type unsealer struct {
 
 	unsealKeys []string
 	rootToken  string
+	// initInfo holds the values exported as "vault-init-info", either from this deployment or from the previous one.
+	initInfo pulumi.MapOutput
+	// ortServerConfigured is true if initInfo holds the AppRole credentials of ORT Server.
+	ortServerConfigured bool
 }
 
-func newUnsealer(ctx *pulumi.Context, name string, opts ...pulumi.ResourceOption) (*unsealer, error) {
+func newUnsealer(
+	ctx *pulumi.Context,
+	name string,
+	args *ClusterArgs,
+	opts ...pulumi.ResourceOption,
+) (*unsealer, error) {
 	component := &unsealer{}
 	err := ctx.RegisterComponentResource("vault:unsealer", name, component, opts...)
 	if err != nil {
@@ -24,7 +32,7 @@ func newUnsealer(ctx *pulumi.Context, name string, opts ...pulumi.ResourceOption
 	}
 
 	if ctx.DryRun() {
-		return component, exportExistingOutputs(ctx, component)
+		return component, exportExistingOutputs(ctx, component, args.Stack)
 	}
 
 	client, err := common.NewKubernetesClient("ort-server")
@@ -32,164 +40,504 @@ func newUnsealer(ctx *pulumi.Context, name string, opts ...pulumi.ResourceOption
 		return nil, err
 	}
 
-	var pods []corev1.Pod
-	podLabel := "app.kubernetes.io/name=vault"
-	deadline := time.Now().Add(time.Minute * 2)
+	pods, err := waitForNodes(nodeNames(args.Replicas), time.Minute*2, client)
+	if err != nil {
+		return nil, err
+	}
 
-	for time.Now().Before(deadline) {
-		pods, err = client.GetPodsWithLabel(podLabel)
+	autoUnseal := args.TransitSeal != nil
+	// PGP encrypted unseal keys can only be used by their owners, so they have to unseal Vault by hand.
+	manualUnseal := len(args.PGPKeys) > 0 && !autoUnseal
+
+	if manualUnseal {
+		revision, err := waitForUpdateRevision(time.Minute, client)
 		if err != nil {
 			return nil, err
 		}
-		if len(pods) > 0 {
-			break
+		if outdated := outdatedPods(pods, revision); len(outdated) > 0 {
+			// Replacing the pods would leave Vault sealed until the key holders unseal it.
+			_ = ctx.Log.Warn(fmt.Sprintf(
+				"The Vault pods %s run an outdated configuration. Delete them one by one and unseal their replacements.",
+				outdated,
+			), nil)
+			return component, exportExistingOutputs(ctx, component, args.Stack)
+		}
+	} else {
+		pods, err = rollOutdatedPods(pods, time.Minute*2, client)
+		if err != nil {
+			return nil, err
 		}
-		time.Sleep(time.Second)
 	}
 
-	isSealed, err := isVaultSealed(&pods[0], client)
-	if err != nil {
-		return nil, err
+	// The readiness probe also succeeds for sealed and uninitialised pods.
+	for i := range pods {
+		if _, err := client.WaitForPod(pods[i].Name, time.Minute); err != nil {
+			return nil, err
+		}
 	}
 
-	if !isSealed {
-		return component, exportExistingOutputs(ctx, component)
+	nodes, err := newPortForwardNodes(args.TLS != nil, client)
+	if err != nil {
+		return nil, err
 	}
 
-	initInfo, err := unseal(pods, client)
+	statuses, err := nodes.statuses(pods)
 	if err != nil {
 		return nil, err
 	}
 
-	outputs := make(pulumi.Map)
-	for i, key := range initInfo.UnsealKeys {
-		name := "vault-unseal-key-%d"
-		outputs[fmt.Sprintf(name, i+1)] = pulumi.ToSecret(key)
+	if leader, ok := findLeader(pods, statuses); ok {
+		// The cluster was initialised by a previous deployment, e.g. all pods were restarted during node maintenance.
+		if manualUnseal && needsUnseal(statuses) {
+			warnManualUnseal(ctx)
+			return component, exportExistingOutputs(ctx, component, args.Stack)
+		}
+
+		initInfo, err := existingInitInfo(args.Stack)
+		if err != nil {
+			return nil, err
+		}
+
+		if needsUnseal(statuses) && !autoUnseal && len(initInfo.UnsealKeys) == 0 {
+			return nil, fmt.Errorf(
+				"vault is initialised but sealed, and the stack output vault-init-info contains no unseal keys",
+			)
+		}
+
+		err = reconcilePods(pods, statuses, leader, initInfo.UnsealKeys, args, nodes)
+		if err != nil {
+			return nil, err
+		}
+
+		leaderPod := findPod(pods, leader)
+		if initInfo.AdminToken != "" {
+			vaultClient, release, err := nodes.connectWithToken(leaderPod, initInfo.AdminToken)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+
+			renewAdminToken(ctx, vaultClient)
+
+			// Like renewing, this fails if the admin token has expired, which should not block deployments.
+			if err := writeAdminPolicy(leaderPod, vaultClient); err != nil {
+				_ = ctx.Log.Warn(fmt.Sprintf("Failed to update the Vault admin policy: %v", err), nil)
+			}
+
+			err = configure(ctx, leaderPod, &initInfo, args, nodes, client)
+			if err != nil {
+				return nil, err
+			}
+
+			return component, exportInitInfo(ctx, component, initInfo)
+		}
+
+		// Stacks initialised before Vault was bootstrapped, or whose bootstrap failed, still hold the root token.
+		initInfo.RootTokenEncrypted = args.RootTokenPGPKey != ""
+		setUp(ctx, leaderPod, &initInfo, args, nodes, client)
+		return component, exportInitInfo(ctx, component, initInfo)
 	}
 
-	outputs["vault-initial-root-key"] = pulumi.ToSecret(initInfo.RootToken)
-	err = ctx.RegisterResourceOutputs(component, outputs)
+	initInfo, err := unseal(pods, statuses, args, nodes)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx.Export("vault-init-info", outputs)
+	if manualUnseal {
+		warnManualUnseal(ctx)
+	} else {
+		setUp(ctx, &pods[0], &initInfo, args, nodes, client)
+	}
 
-	return component, nil
+	return component, exportInitInfo(ctx, component, initInfo)
 }
 
-func exportExistingOutputs(ctx *pulumi.Context, component *unsealer) error {
-	stackRef, err := pulumi.NewStackReference(ctx, ctx.Stack(), nil)
+// setUp bootstraps Vault if initInfo holds the root token but no admin token, and applies the configuration. Failures
+// are only logged, because failing would lose the unseal keys of a new cluster. The next deployment retries, since the
+// root token is exported until the bootstrap succeeds.
+func setUp(
+	ctx *pulumi.Context,
+	pod *corev1.Pod,
+	initInfo *InitInfo,
+	args *ClusterArgs,
+	nodes *vaultNodes,
+	kc *common.KubernetesClient,
+) {
+	if initInfo.RootTokenEncrypted {
+		_ = ctx.Log.Warn("The initial root token is PGP encrypted, skipping the bootstrap configuration of Vault.", nil)
+	} else if initInfo.needsBootstrap() {
+		adminToken, err := bootstrap(pod, initInfo.RootToken, args, nodes)
+		if err != nil {
+			// Keep the root token, otherwise there is no way to finish the configuration besides generating a new one.
+			msg := fmt.Sprintf("Bootstrapping Vault failed, the initial root token has not been revoked: %v", err)
+			_ = ctx.Log.Warn(msg, nil)
+		} else {
+			initInfo.AdminToken = adminToken
+			initInfo.RootToken = ""
+		}
+	}
+
+	err := configure(ctx, pod, initInfo, args, nodes, kc)
+	if err != nil {
+		_ = ctx.Log.Warn(fmt.Sprintf("Configuring Vault failed, run the deployment again: %v", err), nil)
+	}
+}
+
+// exportInitInfo exports initInfo as "vault-init-info", replacing the values of the previous deployment.
+func exportInitInfo(ctx *pulumi.Context, component *unsealer, initInfo InitInfo) error {
+	outputs := make(pulumi.Map)
+	for name, value := range initInfo.outputs() {
+		outputs[name] = pulumi.ToSecret(value)
+	}
+
+	err := ctx.RegisterResourceOutputs(component, outputs)
 	if err != nil {
 		return err
 	}
-	initInfoOutput := stackRef.GetOutput(pulumi.String("vault-init-info"))
-	ctx.Export("vault-init-info", initInfoOutput)
+
+	component.initInfo = outputs.ToMapOutput()
+	component.ortServerConfigured = initInfo.ORTServerSecretID != ""
+	ctx.Export("vault-init-info", component.initInfo)
 	return nil
 }
 
-func isVaultSealed(pod *corev1.Pod, kc *common.KubernetesClient) (bool, error) {
-	var err error
-	pod, err = kc.WaitForPod(pod.Name, time.Minute)
-	if err != nil {
-		return false, err
+// configure applies the configuration that requires a token, i.e. everything besides the Helm release, with the admin
+// token in initInfo. The AppRole credentials of ORT Server are stored in initInfo.
+func configure(
+	ctx *pulumi.Context,
+	pod *corev1.Pod,
+	initInfo *InitInfo,
+	args *ClusterArgs,
+	nodes *vaultNodes,
+	kc *common.KubernetesClient,
+) error {
+	if args.ORTServer == nil && args.Snapshots == nil && args.Audit == nil {
+		return nil
 	}
 
-	output, err := kc.PodExecIgnoreExitCode(pod, "vault status -format=json")
-	if err != nil {
-		return false, err
+	if initInfo.AdminToken == "" {
+		_ = ctx.Log.Warn("There is no Vault admin token, skipping the configuration of Vault.", nil)
+		return nil
 	}
 
-	var status map[string]interface{}
-	err = json.Unmarshal([]byte(output), &status)
+	client, release, err := nodes.connectWithToken(pod, initInfo.AdminToken)
 	if err != nil {
-		return false, err
+		return err
 	}
+	defer release()
 
-	sealed, ok := status["sealed"].(bool)
-	return ok && sealed, nil
-}
+	// The audit devices come first, so that the remaining configuration is recorded in the audit log.
+	if args.Audit != nil {
+		if err := configureAudit(pod, client, args.Audit); err != nil {
+			return err
+		}
+	}
 
-func unseal(pods []corev1.Pod, kc *common.KubernetesClient) (iInfo InitInfo, err error) {
-	// Take the first pod and make it the leader; init & unseal first.
-	leaderPod := &pods[0]
-	leaderName := leaderPod.Name
-	leaderPod, err = kc.WaitForPod(leaderName, time.Minute)
-	if err != nil {
-		return
+	if args.ORTServer != nil {
+		if err := configureORTServer(pod, client, args, initInfo); err != nil {
+			return err
+		}
 	}
 
-	iInfo, err = initPod(leaderPod, kc)
-	if err != nil {
-		return
+	if args.Snapshots != nil {
+		return configureSnapshots(pod, client, kc.Namespace())
 	}
 
-	err = unsealPod(leaderPod, iInfo.UnsealKeys, kc)
+	return nil
+}
+
+func warnManualUnseal(ctx *pulumi.Context) {
+	_ = ctx.Log.Warn(
+		"Vault is sealed and the unseal keys are PGP encrypted. "+
+			"The key holders need to decrypt their key and run \"vault operator unseal\" on every pod.",
+		nil,
+	)
+}
+
+func exportExistingOutputs(ctx *pulumi.Context, component *unsealer, stackRef *pulumi.StackReference) error {
+	existing, err := existingInitInfo(stackRef)
 	if err != nil {
-		return
+		return err
 	}
+	component.ortServerConfigured = existing.ORTServerSecretID != ""
 
-	for i := range pods {
-		pod := &pods[i]
-		if pod.Name == leaderName {
-			continue
+	initInfoOutput := stackRef.GetOutput(pulumi.String("vault-init-info"))
+	component.initInfo = initInfoOutput.ApplyT(func(initInfo interface{}) map[string]interface{} {
+		m, _ := initInfo.(map[string]interface{})
+		return m
+	}).(pulumi.MapOutput)
+	ctx.Export("vault-init-info", component.initInfo)
+	return nil
+}
+
+// unsealKeysOutput returns the unseal keys from initInfo, keyed by their position.
+func (u *unsealer) unsealKeysOutput() pulumi.StringMapOutput {
+	return u.initInfo.ApplyT(func(initInfo map[string]interface{}) map[string]string {
+		keys := make(map[string]string)
+		for i := 1; ; i++ {
+			key, ok := initInfo[fmt.Sprintf("vault-unseal-key-%d", i)].(string)
+			if !ok {
+				return keys
+			}
+			keys[fmt.Sprintf("key-%d", i)] = key
 		}
+	}).(pulumi.StringMapOutput)
+}
+
+// ortServerCredentialsOutput returns the AppRole credentials of ORT Server from initInfo, keyed like the secret
+// ort-server-vault.
+func (u *unsealer) ortServerCredentialsOutput() pulumi.StringMapOutput {
+	return u.initInfo.ApplyT(func(initInfo map[string]interface{}) map[string]string {
+		roleID, _ := initInfo["vault-ort-server-role-id"].(string)
+		secretID, _ := initInfo["vault-ort-server-secret-id"].(string)
+		return map[string]string{"role-id": roleID, "secret-id": secretID}
+	}).(pulumi.StringMapOutput)
+}
+
+// waitForNodes waits until there is a pod for every node and returns them in the order of nodes. Other pods matching
+// podSelector, e.g. ones that are terminating after scaling down, are ignored.
+func waitForNodes(nodes []string, timeout time.Duration, kc *common.KubernetesClient) ([]corev1.Pod, error) {
+	deadline := time.Now().Add(timeout)
 
-		pod, err = kc.WaitForPod(pod.Name, time.Minute)
+	for {
+		found, err := kc.GetPodsWithLabel(podSelector)
 		if err != nil {
-			return
+			return nil, err
 		}
-		if err = joinPod(pod, leaderName, kc); err != nil {
-			return
+
+		pods, missing := selectNodes(found, nodes)
+		if len(missing) == 0 {
+			return pods, nil
 		}
-		if err = unsealPod(pod, iInfo.UnsealKeys, kc); err != nil {
-			return
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("vault pods %s not found after %.0f seconds", missing, timeout.Seconds())
 		}
+		time.Sleep(time.Second)
 	}
-	return
 }
 
-func unsealPod(pod *corev1.Pod, unsealKeys []string, kc *common.KubernetesClient) error {
-	for i, key := range unsealKeys {
-		if i >= 3 {
+// selectNodes returns the pods named like nodes, in the same order, and the names of the nodes without a pod.
+func selectNodes(pods []corev1.Pod, nodes []string) ([]corev1.Pod, []string) {
+	var selected []corev1.Pod
+	var missing []string
+
+	for _, node := range nodes {
+		if pod := findPod(pods, node); pod != nil {
+			selected = append(selected, *pod)
+		} else {
+			missing = append(missing, node)
+		}
+	}
+
+	return selected, missing
+}
+
+// existingInitInfo reads the unseal keys and tokens exported by the deployment that initialised Vault.
+func existingInitInfo(stackRef *pulumi.StackReference) (InitInfo, error) {
+	details, err := stackRef.GetOutputDetails("vault-init-info")
+	if err != nil {
+		return InitInfo{}, err
+	}
+
+	value := details.Value
+	if details.SecretValue != nil {
+		value = details.SecretValue
+	}
+
+	outputs, _ := value.(map[string]interface{})
+	return initInfoFromOutputs(outputs), nil
+}
+
+func initInfoFromOutputs(outputs map[string]interface{}) InitInfo {
+	var initInfo InitInfo
+
+	for i := 1; ; i++ {
+		key, ok := outputs[fmt.Sprintf("vault-unseal-key-%d", i)].(string)
+		if !ok {
 			break
 		}
+		initInfo.UnsealKeys = append(initInfo.UnsealKeys, key)
+	}
 
-		_, err := kc.PodExec(pod, "vault operator unseal "+key)
-		if err != nil {
-			return fmt.Errorf("unsealPod(%s): %w", pod.Name, err)
+	for i := 1; ; i++ {
+		key, ok := outputs[fmt.Sprintf("vault-recovery-key-%d", i)].(string)
+		if !ok {
+			break
 		}
+		initInfo.RecoveryKeys = append(initInfo.RecoveryKeys, key)
+	}
+
+	initInfo.RootToken, _ = outputs["vault-initial-root-key"].(string)
+	initInfo.AdminToken, _ = outputs["vault-admin-token"].(string)
+	initInfo.ORTServerRoleID, _ = outputs["vault-ort-server-role-id"].(string)
+	initInfo.ORTServerSecretID, _ = outputs["vault-ort-server-secret-id"].(string)
+	return initInfo
+}
+
+// outputs returns the keys and tokens by the names they are exported with, the reverse of initInfoFromOutputs.
+func (i InitInfo) outputs() map[string]string {
+	outputs := make(map[string]string)
+	for n, key := range i.UnsealKeys {
+		outputs[fmt.Sprintf("vault-unseal-key-%d", n+1)] = key
+	}
+	for n, key := range i.RecoveryKeys {
+		outputs[fmt.Sprintf("vault-recovery-key-%d", n+1)] = key
+	}
+
+	if i.RootToken != "" {
+		outputs["vault-initial-root-key"] = i.RootToken
+	}
+	if i.AdminToken != "" {
+		outputs["vault-admin-token"] = i.AdminToken
+	}
+	if i.ORTServerSecretID != "" {
+		outputs["vault-ort-server-role-id"] = i.ORTServerRoleID
+		outputs["vault-ort-server-secret-id"] = i.ORTServerSecretID
 	}
 
+	return outputs
+}
+
+// needsBootstrap returns whether the root token still has to be replaced with an admin token.
+func (i InitInfo) needsBootstrap() bool {
+	return i.RootToken != "" && i.AdminToken == "" && !i.RootTokenEncrypted
+}
+
+// vaultStatus is the subset of the health status of a pod used by the unsealer.
+type vaultStatus struct {
+	Initialized bool
+	Sealed      bool
+}
+
+func findPod(pods []corev1.Pod, name string) *corev1.Pod {
+	for i := range pods {
+		if pods[i].Name == name {
+			return &pods[i]
+		}
+	}
 	return nil
 }
 
-type InitInfo struct {
-	UnsealKeys []string `json:"unseal_keys_b64"`
-	RootToken  string   `json:"root_token"`
+// findLeader returns the name of an initialised pod, preferring unsealed ones. It returns false if no pod is
+// initialised, i.e. Vault has never been initialised.
+func findLeader(pods []corev1.Pod, statuses map[string]vaultStatus) (string, bool) {
+	leader := ""
+
+	for _, pod := range pods {
+		status := statuses[pod.Name]
+		if !status.Initialized {
+			continue
+		}
+		if !status.Sealed {
+			return pod.Name, true
+		}
+		if leader == "" {
+			leader = pod.Name
+		}
+	}
+
+	return leader, leader != ""
 }
 
-func initPod(pod *corev1.Pod, kc *common.KubernetesClient) (InitInfo, error) {
-	output, err := kc.PodExec(pod, "vault operator init -format=json")
-	if err != nil {
-		return InitInfo{}, fmt.Errorf("initPod(%s): %w", pod.Name, err)
+func needsUnseal(statuses map[string]vaultStatus) bool {
+	for _, status := range statuses {
+		if !status.Initialized || status.Sealed {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcilePods unseals the leader if necessary and then joins every uninitialised pod to the leader's raft cluster
+// and unseals every sealed pod. Pods that are already unsealed are left alone. With auto-unseal, pods unseal
+// themselves, so they are only joined.
+func reconcilePods(
+	pods []corev1.Pod,
+	statuses map[string]vaultStatus,
+	leaderName string,
+	unsealKeys []string,
+	args *ClusterArgs,
+	nodes *vaultNodes,
+) error {
+	autoUnseal := args.TransitSeal != nil
+	ordered := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Name == leaderName {
+			ordered = append([]corev1.Pod{pod}, ordered...)
+		} else {
+			ordered = append(ordered, pod)
+		}
 	}
 
-	return parseInitOutput(output)
+	for i := range ordered {
+		pod := &ordered[i]
+		status := statuses[pod.Name]
+
+		if !status.Initialized {
+			if err := nodes.join(pod, leaderName); err != nil {
+				return err
+			}
+			status.Sealed = true
+		}
+
+		if !status.Sealed || autoUnseal {
+			continue
+		}
+
+		if err := nodes.unseal(pod, unsealKeys, args.KeyThreshold); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func joinPod(pod *corev1.Pod, leaderPodName string, kc *common.KubernetesClient) error {
-	cmd := fmt.Sprintf("vault operator raft join http://%s.vault-internal:8200", leaderPodName)
-	_, err := kc.PodExec(pod, cmd)
+// unseal initialises the first pod and joins the others to its raft cluster. With auto-unseal, Vault returns recovery
+// keys instead of unseal keys on initialisation and the pods unseal themselves. With PGP encrypted unseal keys, Vault
+// is only initialised and the pods join the cluster once the key holders have unsealed them.
+func unseal(
+	pods []corev1.Pod,
+	statuses map[string]vaultStatus,
+	args *ClusterArgs,
+	nodes *vaultNodes,
+) (iInfo InitInfo, err error) {
+	// Take the first pod and make it the leader; init & unseal first.
+	leaderPod := &pods[0]
+	leaderName := leaderPod.Name
+
+	iInfo, err = nodes.init(leaderPod, args)
 	if err != nil {
-		return fmt.Errorf("joinPod(%s, %s): %w", pod.Name, leaderPodName, err)
+		return
 	}
 
-	return nil
+	autoUnseal := args.TransitSeal != nil
+	if iInfo.Encrypted && !autoUnseal {
+		return
+	}
+
+	statuses[leaderName] = vaultStatus{Initialized: true, Sealed: true}
+	err = reconcilePods(pods, statuses, leaderName, iInfo.UnsealKeys, args, nodes)
+	return
 }
 
-func parseInitOutput(output string) (InitInfo, error) {
-	var initInfo InitInfo
-	err := json.Unmarshal([]byte(output), &initInfo)
-	return initInfo, err
+// InitInfo is the result of initialising Vault, with base64 encoded keys. If PGP keys were given, the keys and possibly
+// the root token are encrypted with them.
+type InitInfo struct {
+	UnsealKeys        []string
+	UnsealShares      int
+	UnsealThreshold   int
+	RecoveryKeys      []string
+	RecoveryShares    int
+	RecoveryThreshold int
+	RootToken         string
+	// Encrypted is true if the unseal or recovery keys are PGP encrypted.
+	Encrypted bool
+	// RootTokenEncrypted is true if the root token is PGP encrypted.
+	RootTokenEncrypted bool
+	// AdminToken is the token created by bootstrap to replace the root token.
+	AdminToken string
+	// ORTServerRoleID and ORTServerSecretID are the AppRole credentials of ORT Server, empty if Vault has not been
+	// configured for it.
+	ORTServerRoleID   string
+	ORTServerSecretID string
 }
@@ -1,21 +1,82 @@
 package vault
 
 import (
+	"github.com/haikoschol/ort-server-pulumi-go/common"
 	pulumiv1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v3"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
-	"os"
+	"time"
 )
 
+// fullName is the prefix of all Kubernetes objects created by the Helm chart. It must match fullnameOverride in
+// override-values.yml.
+const fullName = "vault"
+
+// podSelector matches the Vault server pods created by the Helm chart.
+const podSelector = "app.kubernetes.io/name=vault,component=server"
+
 type Cluster struct {
 	pulumi.ResourceState
 
+	// ServiceName is the name of the service load-balancing across all Vault pods.
+	ServiceName pulumi.StringOutput
+	// InternalServiceName is the name of the headless service used for addressing individual pods.
+	InternalServiceName pulumi.StringOutput
+	Port                pulumi.IntOutput
+	// Address is the URL clients in the cluster use to connect to Vault.
+	Address pulumi.StringOutput
+	// ORTServerMountPath is the path of the KV v2 secrets engine for ORT Server.
+	ORTServerMountPath pulumi.StringOutput
+	// ORTServerSecretName is the name of the secret with the keys "role-id" and "secret-id" ORT Server logs in with.
+	ORTServerSecretName pulumi.StringOutput
+	// ORTServerConfigured is true once the unsealer has exported the AppRole credentials of ORT Server, which the
+	// secret ORTServerSecretName is created from. Until then, ORT Server must not use Vault.
+	ORTServerConfigured bool
+	// CASecretName is the name of the secret containing the CA certificate ("ca.crt") clients use to verify Vault's
+	// certificate. It is empty if TLS is disabled.
+	CASecretName pulumi.StringOutput
+
 	release  *helm.Release
 	unsealer *unsealer
+	// tlsServerSecret holds the certificates created by this program, nil if they are issued by cert-manager.
+	tlsServerSecret *pulumiv1.Secret
 }
 
 type ClusterArgs struct {
 	Namespace *pulumiv1.Namespace
+	// Stack references the outputs of the last update, see common.NewSelfReference. The unsealer reads the unseal keys
+	// and tokens from it.
+	Stack        *pulumi.StackReference
+	ChartVersion string
+	ImageTag     string
+	Replicas     int
+	// ClusterName is the name of the raft cluster, e.g. shown in telemetry and the output of "vault status".
+	ClusterName string
+	// TransitSeal enables auto-unseal via the transit secrets engine if not nil. Otherwise Vault is initialised with
+	// Shamir unseal keys and unsealed by this program.
+	TransitSeal *TransitSealArgs
+	// KeyShares and KeyThreshold are the number of key shares created when Vault is initialised and how many of them
+	// are required to unseal it. With auto-unseal they apply to the recovery keys.
+	KeyShares    int
+	KeyThreshold int
+	// PGPKeys are base64 encoded PGP public keys, one per key share. If set, every key share is encrypted with one of
+	// them and Vault has to be unsealed by the key holders.
+	PGPKeys []string
+	// RootTokenPGPKey is a base64 encoded PGP public key used to encrypt the initial root token if not empty.
+	RootTokenPGPKey string
+	// AdminTokenPeriod is the period of the admin token that replaces the initial root token, e.g. "768h".
+	AdminTokenPeriod string
+	// TLS enables TLS for the Vault API and raft cluster traffic if not nil.
+	TLS *TLSArgs
+	// ORTServer configures a secrets engine, policy and AppRole for ORT Server if not nil. This requires the admin
+	// token created when Vault is bootstrapped.
+	ORTServer *ORTServerArgs
+	// Audit enables audit devices writing to a dedicated volume if not nil.
+	Audit *AuditArgs
+	// Snapshots creates a CronJob saving raft snapshots to an S3 compatible bucket if not nil.
+	Snapshots *SnapshotArgs
+	// UnsealController deploys a controller that unseals and joins restarted Vault pods if not nil.
+	UnsealController *UnsealControllerArgs
 }
 
 func NewCluster(ctx *pulumi.Context, name string, args *ClusterArgs, opts ...pulumi.ResourceOption) (*Cluster, error) {
@@ -26,11 +87,121 @@ func NewCluster(ctx *pulumi.Context, name string, args *ClusterArgs, opts ...pul
 		return nil, err
 	}
 
-	nodeConfig, err := os.ReadFile("./vault/node-config.hcl")
+	configData := newNodeConfigData(args)
+	var dependencies []pulumi.Resource
+	var extraVolumes pulumi.MapArray
+	serverValues := pulumi.Map{}
+
+	if args.TransitSeal != nil {
+		configData.Transit, dependencies, err = createTransitSeal(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+
+		serverValues["extraSecretEnvironmentVars"] = pulumi.MapArray{
+			pulumi.Map{
+				"envName":    pulumi.String("VAULT_TOKEN"),
+				"secretName": pulumi.String(transitTokenSecretName),
+				"secretKey":  pulumi.String("token"),
+			},
+		}
+		if args.TransitSeal.TLSCACert != "" {
+			extraVolumes = append(extraVolumes, pulumi.Map{
+				"type": pulumi.String("secret"),
+				"name": pulumi.String(transitCASecretName),
+			})
+		}
+	}
+
+	if args.TLS != nil {
+		tlsDependencies, err := createTLS(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, tlsDependencies...)
+
+		configData.TLS = newTLSFiles(args.TLS)
+		extraVolumes = append(extraVolumes,
+			pulumi.Map{
+				"type": pulumi.String("secret"),
+				"name": pulumi.String(serverSecretName(args.TLS)),
+			},
+			pulumi.Map{
+				"type": pulumi.String("secret"),
+				"name": pulumi.String(tlsCASecretName),
+			},
+		)
+		serverValues["extraEnvironmentVars"] = pulumi.Map{
+			"VAULT_CACERT": pulumi.String(configData.TLS.CAFile),
+		}
+		if component.tlsServerSecret != nil {
+			// Vault only reads its certificate on startup. Changing the pod template when the certificates are renewed
+			// makes the unsealer replace the pods, see rollOutdatedPods.
+			serverValues["annotations"] = pulumi.StringMap{
+				"ort-server/tls-secret-version": component.tlsServerSecret.Metadata.ResourceVersion().Elem(),
+			}
+		}
+	}
+
+	if args.Audit != nil {
+		auditValues, auditDependencies, err := auditServerValues(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range auditValues {
+			serverValues[key] = value
+		}
+		dependencies = append(dependencies, auditDependencies...)
+	}
+
+	if args.TLS != nil && args.TLS.Issuer != nil {
+		// The sidecar has to see the Vault process to send it SIGHUP.
+		containers, _ := serverValues["extraContainers"].(pulumi.MapArray)
+		serverValues["extraContainers"] = append(containers, tlsReloadContainer(args))
+		serverValues["shareProcessNamespace"] = pulumi.Bool(true)
+	}
+
+	if len(extraVolumes) > 0 {
+		serverValues["extraVolumes"] = extraVolumes
+	}
+
+	nodeConfig, err := renderNodeConfig("./vault/node-config.hcl.tmpl", configData)
 	if err != nil {
 		return nil, err
 	}
 
+	serverValues["image"] = pulumi.Map{
+		"tag": pulumi.String(args.ImageTag),
+	}
+	serverValues["ha"] = pulumi.Map{
+		"replicas": pulumi.Int(args.Replicas),
+		"raft": pulumi.Map{
+			"config": pulumi.String(nodeConfig),
+		},
+	}
+
+	// The Kubernetes API is only used outside of previews, like in the unsealer.
+	if !ctx.DryRun() {
+		client, err := common.NewKubernetesClient("ort-server")
+		if err != nil {
+			return nil, err
+		}
+		claimsChanged, err := volumeClaimsChanged(volumeClaims(args), client)
+		if err != nil {
+			return nil, err
+		}
+		if claimsChanged {
+			_ = ctx.Log.Warn(
+				"Deleting the Vault StatefulSet without its pods, because its volume claims change. The Helm upgrade "+
+					"creates it again and the pods are replaced one by one afterwards.",
+				nil,
+			)
+			if err := recreateStatefulSet(time.Minute, client); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	component.release, err = helm.NewRelease(
 		ctx,
 		"vault",
@@ -39,29 +210,93 @@ func NewCluster(ctx *pulumi.Context, name string, args *ClusterArgs, opts ...pul
 			RepositoryOpts: helm.RepositoryOptsArgs{
 				Repo: pulumi.String("https://helm.releases.hashicorp.com"),
 			},
-			Version:   pulumi.String("0.27.0"),
+			Version:   pulumi.String(args.ChartVersion),
 			Namespace: args.Namespace.Metadata.Name(),
 			ValueYamlFiles: pulumi.AssetOrArchiveArray{
 				pulumi.NewFileAsset("./vault/override-values.yml"),
 			},
 			Values: pulumi.Map{
-				"ha": pulumi.Map{
-					"raft": pulumi.Map{
-						"config": pulumi.String(nodeConfig),
-					},
+				"global": pulumi.Map{
+					"tlsDisable": pulumi.Bool(args.TLS == nil),
 				},
+				"server": serverValues,
 			},
 		},
+		pulumi.DependsOn(dependencies),
 		pulumi.ResourceOption(pulumi.Parent(component)),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	component.unsealer, err = newUnsealer(ctx, "vault-unsealer", pulumi.Parent(component.release))
+	component.unsealer, err = newUnsealer(ctx, "vault-unsealer", args, pulumi.Parent(component.release))
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Snapshots != nil {
+		err = createSnapshotCronJob(ctx, component, args, configData.Scheme())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if args.UnsealController != nil {
+		err = createUnsealController(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	namespace := component.release.Status.Namespace().Elem()
+	component.ServiceName = pulumi.String(fullName).ToStringOutput()
+	component.InternalServiceName = pulumi.String(fullName + "-internal").ToStringOutput()
+	component.Port = pulumi.Int(8200).ToIntOutput()
+	component.Address = pulumi.Sprintf(
+		"%s://%s.%s.svc:%d",
+		configData.Scheme(),
+		component.ServiceName,
+		namespace,
+		component.Port,
+	)
+
+	// The unsealer has configured Vault for ORT Server by now, unless Vault is sealed or has no admin token. During a
+	// preview, the credentials of the previous deployment are used.
+	component.ORTServerMountPath = pulumi.String("").ToStringOutput()
+	component.ORTServerSecretName = pulumi.String("").ToStringOutput()
+	if args.ORTServer != nil {
+		component.ORTServerConfigured = component.unsealer.ortServerConfigured
+		if !component.ORTServerConfigured {
+			_ = ctx.Log.Warn("Vault has not been configured for ORT Server yet, ORT Server does not use Vault.", nil)
+		}
+	}
+
+	if component.ORTServerConfigured {
+		secret, err := createORTServerSecret(ctx, component, args)
+		if err != nil {
+			return nil, err
+		}
+		component.ORTServerMountPath = pulumi.String(args.ORTServer.MountPath).ToStringOutput()
+		component.ORTServerSecretName = secret.Metadata.Name().Elem()
+	}
+
+	component.CASecretName = pulumi.String("").ToStringOutput()
+	if args.TLS != nil {
+		component.CASecretName = pulumi.String(tlsCASecretName).ToStringOutput()
+	}
+
+	err = ctx.RegisterResourceOutputs(component, pulumi.Map{
+		"serviceName":         component.ServiceName,
+		"internalServiceName": component.InternalServiceName,
+		"port":                component.Port,
+		"address":             component.Address,
+		"caSecretName":        component.CASecretName,
+		"ortServerMountPath":  component.ORTServerMountPath,
+		"ortServerSecretName": component.ORTServerSecretName,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return component, err
+	return component, nil
 }
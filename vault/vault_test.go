@@ -1,68 +1,184 @@
 package vault
 
 import (
-	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"slices"
 	"testing"
 )
 
-func TestParseInitOutput(t *testing.T) {
-	expectedUnsealKeys := []string{
-		"key1",
-		"key2",
-		"key3",
-		"key4",
-		"key5",
-	}
-
-	expectedRootToken := "faketokenisfake"
-
-	output := fmt.Sprintf(`{
-  "unseal_keys_b64": [
-	"%s",
-	"%s",
-	"%s",
-	"%s",
-	"%s"
-  ],
-  "unseal_keys_hex": [
-	"hexkey1",
-	"hexkey2",
-	"hexkey3",
-	"hexkey4",
-	"hexkey5"
-  ],
-  "unseal_shares": 5,
-  "unseal_threshold": 3,
-  "recovery_keys_b64": [],
-  "recovery_keys_hex": [],
-  "recovery_keys_shares": 0,
-  "recovery_keys_threshold": 0,
-  "root_token": "%s"
-}`,
-		expectedUnsealKeys[0],
-		expectedUnsealKeys[1],
-		expectedUnsealKeys[2],
-		expectedUnsealKeys[3],
-		expectedUnsealKeys[4],
-		expectedRootToken)
-
-	initInfo, err := parseInitOutput(output)
-
-	if err != nil {
-		t.Fatalf("parseInitOutput() returned an unexpected error: %v", err)
-	}
-
-	if len(initInfo.UnsealKeys) != len(expectedUnsealKeys) {
-		t.Fatalf("expected %d unseal keys, got %d", len(expectedUnsealKeys), len(initInfo.UnsealKeys))
-	}
-
-	for i, key := range initInfo.UnsealKeys {
-		if key != expectedUnsealKeys[i] {
-			t.Fatalf("expected unseal key %d to be %s, got %s", i, expectedUnsealKeys[i], key)
+func TestInitInfoFromOutputs(t *testing.T) {
+	outputs := map[string]interface{}{
+		"vault-unseal-key-1":     "key1",
+		"vault-unseal-key-2":     "key2",
+		"vault-unseal-key-3":     "key3",
+		"vault-initial-root-key": "faketokenisfake",
+		"vault-admin-token":      "fakeadmintoken",
+	}
+
+	initInfo := initInfoFromOutputs(outputs)
+
+	if !slices.Equal(initInfo.UnsealKeys, []string{"key1", "key2", "key3"}) {
+		t.Errorf("unexpected unseal keys: %v", initInfo.UnsealKeys)
+	}
+	if len(initInfo.RecoveryKeys) != 0 {
+		t.Errorf("unexpected recovery keys: %v", initInfo.RecoveryKeys)
+	}
+	if initInfo.RootToken != "faketokenisfake" {
+		t.Errorf("unexpected root token: %s", initInfo.RootToken)
+	}
+	if initInfo.AdminToken != "fakeadmintoken" {
+		t.Errorf("unexpected admin token: %s", initInfo.AdminToken)
+	}
+}
+
+func TestMigrateExistingStack(t *testing.T) {
+	// The outputs of a stack initialised before Vault was bootstrapped.
+	outputs := map[string]interface{}{
+		"vault-unseal-key-1":     "key1",
+		"vault-unseal-key-2":     "key2",
+		"vault-initial-root-key": "faketokenisfake",
+	}
+
+	initInfo := initInfoFromOutputs(outputs)
+	if !initInfo.needsBootstrap() {
+		t.Fatalf("expected a stack with the root token and without an admin token to be bootstrapped")
+	}
+
+	initInfo.RootTokenEncrypted = true
+	if initInfo.needsBootstrap() {
+		t.Fatalf("expected a stack with an encrypted root token not to be bootstrapped")
+	}
+	initInfo.RootTokenEncrypted = false
+
+	initInfo.AdminToken = "fakeadmintoken"
+	initInfo.RootToken = ""
+	migrated := initInfo.outputs()
+
+	expected := map[string]string{
+		"vault-unseal-key-1": "key1",
+		"vault-unseal-key-2": "key2",
+		"vault-admin-token":  "fakeadmintoken",
+	}
+	if len(migrated) != len(expected) {
+		t.Fatalf("expected outputs %v, got %v", expected, migrated)
+	}
+	for name, value := range expected {
+		if migrated[name] != value {
+			t.Fatalf("expected output %s to be %s, got %q", name, value, migrated[name])
 		}
 	}
 
-	if initInfo.RootToken != expectedRootToken {
-		t.Fatalf("expected initial root token to be %s, got %s", expectedRootToken, initInfo.RootToken)
+	next := make(map[string]interface{})
+	for name, value := range migrated {
+		next[name] = value
+	}
+	if initInfoFromOutputs(next).needsBootstrap() {
+		t.Fatalf("expected the next deployment not to bootstrap again")
+	}
+}
+
+func TestFindLeader(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-0"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-2"}},
+	}
+
+	statuses := map[string]vaultStatus{
+		"vault-0": {Initialized: false, Sealed: true},
+		"vault-1": {Initialized: true, Sealed: true},
+		"vault-2": {Initialized: true, Sealed: false},
+	}
+
+	leader, ok := findLeader(pods, statuses)
+	if !ok || leader != "vault-2" {
+		t.Errorf("expected vault-2 to be the leader, got %q", leader)
+	}
+
+	statuses["vault-2"] = vaultStatus{Initialized: true, Sealed: true}
+	leader, ok = findLeader(pods, statuses)
+	if !ok || leader != "vault-1" {
+		t.Errorf("expected vault-1 to be the leader, got %q", leader)
+	}
+
+	_, ok = findLeader(pods, map[string]vaultStatus{})
+	if ok {
+		t.Error("expected no leader for an uninitialised cluster")
+	}
+}
+
+func TestSelectNodes(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-3"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-0"}},
+	}
+
+	selected, missing := selectNodes(pods, nodeNames(3))
+
+	var names []string
+	for _, pod := range selected {
+		names = append(names, pod.Name)
+	}
+
+	if !slices.Equal(names, []string{"vault-0", "vault-1"}) {
+		t.Errorf("unexpected selected pods: %v", names)
+	}
+	if !slices.Equal(missing, []string{"vault-2"}) {
+		t.Errorf("unexpected missing nodes: %v", missing)
+	}
+}
+
+func TestOutdatedPods(t *testing.T) {
+	deleted := metav1.Now()
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-0", Labels: map[string]string{revisionLabel: "vault-new"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "vault-1", Labels: map[string]string{revisionLabel: "vault-old"}}},
+		{ObjectMeta: metav1.ObjectMeta{
+			Name:              "vault-2",
+			Labels:            map[string]string{revisionLabel: "vault-new"},
+			DeletionTimestamp: &deleted,
+		}},
+	}
+
+	outdated := outdatedPods(pods, "vault-new")
+	if !slices.Equal(outdated, []string{"vault-1", "vault-2"}) {
+		t.Fatalf("expected vault-1 and the terminating vault-2 to be outdated, got %v", outdated)
+	}
+}
+
+func TestUpdateRevision(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Status:     appsv1.StatefulSetStatus{ObservedGeneration: 1, UpdateRevision: "vault-old"},
+	}
+	if _, ok := updateRevision(statefulSet); ok {
+		t.Fatalf("expected no revision before the controller observed the last change")
+	}
+
+	statefulSet.Status = appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdateRevision: "vault-new"}
+	if revision, ok := updateRevision(statefulSet); !ok || revision != "vault-new" {
+		t.Fatalf("expected revision vault-new, got %q", revision)
+	}
+}
+
+func TestClaimTemplateNames(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{
+		Spec: appsv1.StatefulSetSpec{
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "data"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "audit"}},
+			},
+		},
+	}
+
+	names := claimTemplateNames(statefulSet)
+	if !slices.Equal(names, volumeClaims(&ClusterArgs{Audit: &AuditArgs{}})) {
+		t.Fatalf("expected the claims of a cluster with audit storage, got %v", names)
+	}
+	if slices.Equal(names, volumeClaims(&ClusterArgs{})) {
+		t.Fatalf("expected the claims of a cluster without audit storage to differ, got %v", names)
 	}
 }